@@ -0,0 +1,283 @@
+// Package audit keeps a tamper-evident JSON lines log of executed commands.
+//
+// Every record carries the hash of the one before it and its own hash over
+// both, so editing, dropping or reordering lines breaks the chain at that
+// point, see Verify. Rotated files continue the chain of the file before.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Record is one executed command.
+type Record struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Mode       string    `json:"mode"`
+	Host       string    `json:"host"`
+	Command    string    `json:"command"`
+	Argv       []string  `json:"argv,omitempty"`
+	Exit       int       `json:"exit"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+	State      string    `json:"state,omitempty"`
+
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// Defaults for Options.
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultKeep    = 5
+)
+
+type Options struct {
+	// Rotate once the file grows past MaxSize bytes
+	MaxSize int64
+	// Rotated files kept as path.1 (newest) to path.Keep
+	Keep int
+	// Recorded as Record.User, defaults to the OS user
+	User string
+}
+
+// Log appends records to a file, safe for concurrent use.
+type Log struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	seq  int64
+	last string
+	size int64
+}
+
+// Open continues the chain of an existing log at path or starts a new one.
+func Open(path string, opts Options) (*Log, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = DefaultKeep
+	}
+	if opts.User == "" {
+		opts.User = currentUser()
+	}
+	l := &Log{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := dropTornTail(path); err != nil {
+		return nil, err
+	}
+	// the chain head is the last record of the newest file that has one
+	for _, p := range l.files() {
+		recs, err := readFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(recs) > 0 {
+			r := recs[len(recs)-1]
+			l.seq, l.last = r.Seq, r.Hash
+		}
+	}
+	if fi, err := os.Stat(path); err == nil {
+		l.size = fi.Size()
+	}
+	return l, nil
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append chains r to the log, filling in Seq, User, Time, Prev and Hash.
+func (l *Log) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.User == "" {
+		r.User = l.opts.User
+	}
+	r.Seq = l.seq + 1
+	r.Prev = l.last
+	r.Hash = hashRecord(r)
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	l.size += int64(len(line))
+	return nil
+}
+
+// Records returns up to limit of the newest records, oldest first, reading
+// rotated files as needed. A limit of 0 returns everything.
+func (l *Log) Records(limit int) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []Record
+	files := l.files()
+	for i := len(files) - 1; i >= 0; i-- {
+		recs, err := readFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		out = append(recs, out...)
+		if limit > 0 && len(out) >= limit {
+			return out[len(out)-limit:], nil
+		}
+	}
+	return out, nil
+}
+
+// Verify checks the hash chain across the rotated files and the log,
+// returning how many records it checked. Keep rotating files whole: the
+// oldest one kept starts the chain wherever it starts.
+func (l *Log) Verify() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Verify(l.files()...)
+}
+
+// Verify checks the hash chain over files given oldest first.
+func Verify(files ...string) (int, error) {
+	n := 0
+	var prev string
+	first := true
+	for _, p := range files {
+		recs, err := readFile(p)
+		if err != nil {
+			return n, err
+		}
+		for _, r := range recs {
+			if !first && r.Prev != prev {
+				return n, fmt.Errorf("%s: record %d does not follow the one before it", p, r.Seq)
+			}
+			if hashRecord(r) != r.Hash {
+				return n, fmt.Errorf("%s: record %d was modified", p, r.Seq)
+			}
+			prev, first = r.Hash, false
+			n++
+		}
+	}
+	return n, nil
+}
+
+// files lists the rotated files, oldest first, then the log itself.
+func (l *Log) files() []string {
+	var out []string
+	for i := l.opts.Keep; i >= 1; i-- {
+		p := fmt.Sprintf("%s.%d", l.path, i)
+		if _, err := os.Stat(p); err == nil {
+			out = append(out, p)
+		}
+	}
+	return append(out, l.path)
+}
+
+func (l *Log) rotate() error {
+	oldest := fmt.Sprintf("%s.%d", l.path, l.opts.Keep)
+	if err := os.Remove(oldest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := l.opts.Keep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", l.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", l.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	l.size = 0
+	return nil
+}
+
+// dropTornTail cuts off a last line that a crash left half written. Records
+// are written whole with their newline, so only a final line without one can
+// be torn; anything else that does not parse still fails loudly.
+func dropTornTail(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	keep := bytes.LastIndexByte(data, '\n') + 1
+	logrus.Warnf("Dropping a torn last record (%d bytes) from %s", len(data)-keep, path)
+	return os.Truncate(path, int64(keep))
+}
+
+// hashRecord hashes the record as JSON without its own hash, which
+// includes Prev and so the whole chain before it.
+func hashRecord(r Record) string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
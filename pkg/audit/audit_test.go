@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openLog(t *testing.T, path string, opts Options) *Log {
+	t.Helper()
+	opts.User = "tester"
+	l, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func appendN(t *testing.T, l *Log, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := l.Append(Record{Mode: "local", Command: fmt.Sprintf("echo %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidChainVerifies(t *testing.T) {
+	l := openLog(t, filepath.Join(t.TempDir(), "audit.jsonl"), Options{})
+	appendN(t, l, 5)
+	if n, err := l.Verify(); err != nil || n != 5 {
+		t.Fatalf("Verify = %d, %v, want 5 records", n, err)
+	}
+}
+
+func TestVerifyReportsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		want   string
+	}{
+		{"edited", func(lines [][]byte) [][]byte {
+			lines[2] = bytes.Replace(lines[2], []byte("echo 2"), []byte("echo X"), 1)
+			return lines
+		}, "record 3 was modified"},
+		{"deleted middle", func(lines [][]byte) [][]byte {
+			return append(lines[:2:2], lines[3:]...)
+		}, "record 4 does not follow"},
+		{"reordered", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, "does not follow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			appendN(t, openLog(t, path, Options{}), 5)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+			lines = tt.tamper(lines)
+			if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err = Verify(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainContinuesAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := openLog(t, path, Options{MaxSize: 600, Keep: 10})
+	appendN(t, l, 12)
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("expected at least two rotations: %v", err)
+	}
+	if n, err := l.Verify(); err != nil || n != 12 {
+		t.Fatalf("Verify = %d, %v, want 12 records", n, err)
+	}
+	recs, err := l.Records(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range recs {
+		if r.Seq != int64(i+1) {
+			t.Errorf("record %d has seq %d", i, r.Seq)
+		}
+	}
+}
+
+func TestReopenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	appendN(t, openLog(t, path, Options{}), 3)
+	l := openLog(t, path, Options{})
+	appendN(t, l, 2)
+	if n, err := l.Verify(); err != nil || n != 5 {
+		t.Fatalf("Verify after reopen = %d, %v, want 5 records", n, err)
+	}
+	recs, _ := l.Records(1)
+	if len(recs) != 1 || recs[0].Seq != 5 {
+		t.Errorf("last record = %+v, want seq 5", recs)
+	}
+}
+
+func TestOpenDropsTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	appendN(t, openLog(t, path, Options{}), 3)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":4,"time":"2024-01`)
+	f.Close()
+
+	l := openLog(t, path, Options{})
+	appendN(t, l, 1)
+	if n, err := l.Verify(); err != nil || n != 4 {
+		t.Fatalf("Verify after torn line = %d, %v, want 4 records", n, err)
+	}
+}
+
+func TestOpenFailsOnCorruptMiddleLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	appendN(t, openLog(t, path, Options{}), 2)
+	data, _ := os.ReadFile(path)
+	data = append([]byte("not json\n"), data...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, Options{}); err == nil {
+		t.Error("Open of a log with a corrupt complete line should fail")
+	}
+}
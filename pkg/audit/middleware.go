@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+)
+
+// Env describes where a run happens, asked for by Middleware on each run.
+type Env struct {
+	Host  string
+	State string
+}
+
+// Middleware appends a record for every run that reaches a real executor,
+// dry and demo runs start nothing and are skipped. Results are expected to be
+// redacted already, see execx.Redact; errors are masked here, and runs with
+// an Options.Label are recorded by the label alone. Audit failures are
+// logged and never fail the command, which already ran.
+func (l *Log) Middleware(env func() Env) execx.Middleware {
+	return func(next execx.Handler) execx.Handler {
+		return func(c execx.Call) (execx.Result, error) {
+			start := time.Now()
+			res, err := next(c)
+			if c.Mode == execx.ModeDryRun || c.Mode == execx.ModeDemo {
+				return res, err
+			}
+			r := Record{
+				Mode:       c.Mode.String(),
+				Command:    res.Command,
+				Argv:       res.Argv,
+				Exit:       res.ExitCode,
+				DurationMS: time.Since(start).Milliseconds(),
+			}
+			// nothing rendered when the template failed, keep what was asked for
+			switch {
+			case c.Opts.Label != "":
+				r.Command, r.Argv = c.Opts.Label, nil
+			case r.Command != "":
+			case len(c.Argv) > 0:
+				r.Command = secret.Redact(execx.QuoteArgv(c.Argv))
+			default:
+				r.Command = secret.Redact(c.Template)
+			}
+			if err != nil {
+				r.Error = secret.Redact(err.Error())
+			}
+			if env != nil {
+				e := env()
+				r.Host, r.State = e.Host, e.State
+			}
+			if aerr := l.Append(r); aerr != nil {
+				logrus.Errorf("Failed to write audit record to %s: %v", l.path, aerr)
+			}
+			return res, err
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package domain
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ourorg/goui/pkg/audit"
 	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/spec"
 )
 
 // Command represents a command that can be executed in the application
@@ -27,6 +30,81 @@ type Command struct {
 
 	// Framework-provided info sink
 	SetInfo func(string)
+
+	// Keep invocations out of the command history, e.g. for history browsing itself
+	NoHistory bool
+
+	// Bulk commands run once per selected entry, with Ctx.Target set to its ID
+	Bulk bool
+	// Run the bulk targets concurrently instead of one after another
+	Parallel bool
+
+	// Danger makes the engine ask before dispatching, see Engine.Confirm
+	Danger Danger
+	// Word to type to confirm a DangerHigh command, defaults to the first alias
+	ConfirmWord string
+	// Mutating commands change something outside the app and are refused
+	// in read-only mode, dangerous commands always count as mutating
+	Mutating bool
+
+	// Env, dir, stdin and limits for what the command runs, layered over
+	// the state's ExecOptions
+	ExecOptions execx.Options
+	// Repeat runs that fail in a flaky way, e.g. execx.SSHRetry
+	Retry *execx.RetryPolicy
+
+	// Sensitive commands take secrets as args, only the alias is kept in
+	// history and shown in events, jobs and prompts, see Line
+	Sensitive bool
+
+	// Background commands return at once and run as a job, see the jobs
+	// builtin; their handler runs on its own goroutine
+	Background bool
+}
+
+// Danger classifies how much harm a command can do when fired by mistake
+type Danger int
+
+const (
+	DangerNone Danger = iota
+	DangerLow         // confirm with y/yes
+	DangerHigh        // confirm by typing the ConfirmWord
+)
+
+func (d Danger) String() string {
+	switch d {
+	case DangerLow:
+		return "low"
+	case DangerHigh:
+		return "high"
+	default:
+		return "none"
+	}
+}
+
+// IsMutating reports whether read-only mode refuses the command
+func (c *Command) IsMutating() bool {
+	return c.Mutating || c.Danger != DangerNone
+}
+
+// Line is the command line as history, events, jobs and prompts show it,
+// the alias alone for Sensitive commands
+func (c *Command) Line(alias string, args []string) string {
+	if c.Sensitive {
+		return alias
+	}
+	return strings.Join(append([]string{alias}, args...), " ")
+}
+
+// ConfirmationWord is what has to be typed to run a DangerHigh command
+func (c *Command) ConfirmationWord() string {
+	if c.ConfirmWord != "" {
+		return c.ConfirmWord
+	}
+	if len(c.Aliases) > 0 {
+		return c.Aliases[0]
+	}
+	return "yes"
 }
 
 // Ctx provides context for command execution
@@ -41,8 +119,56 @@ type Ctx struct {
 	// TODO19 architecture: StateWriter for clean state mutations
 	State StateWriter
 
-	// optional future hooks
-	// SetExecMode func(mode execx.Mode, cfg execx.Config) error
+	// Command history, most relevant first
+	History HistoryReader
+
+	// Dispatch runs a full command line as if typed, e.g. to re-run history
+	Dispatch func(line string) (string, error)
+
+	// Spec builds what the current state shows, after the filter pipeline
+	Spec func() spec.Spec
+
+	// Args of the current state, read only
+	StateArgs map[string]interface{}
+
+	// Selected entry IDs of the current table or list
+	Selection []string
+	// Entry ID a bulk command is running for, empty otherwise
+	Target string
+
+	// SetExecMode switches where commands run once the current one returns
+	SetExecMode func(mode execx.Mode, cfg execx.Config) error
+	// Named exec targets the app configured
+	ExecProfiles map[string]execx.Config
+	// Config of the current executor
+	ExecConfig execx.Config
+
+	// Log of executed commands, nil when auditing is off
+	Audit *audit.Log
+
+	// Background jobs
+	Jobs JobControl
+	// Done when the command should stop, e.g. its background job was
+	// canceled. Exec already honors it.
+	Context context.Context
+
+	// Progress of long running handlers, forwarded to Engine.OnProgress
+	Progress *ProgressReporter
+
+	// Blocking runs wait, e.g. waiting for a job, letting other callers use
+	// the engine meanwhile; nil runs it directly
+	Blocking func(wait func())
+}
+
+// TemplateData is the data CmdTmpl is rendered with, see package tmpl for
+// the functions templates can use
+func (c *Ctx) TemplateData(args []string) map[string]interface{} {
+	return map[string]interface{}{
+		"Args":      args,
+		"Target":    c.Target,
+		"Selection": c.Selection,
+		"State":     c.StateArgs,
+	}
 }
 
 // RegistryReader provides read-only access to registry data
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// HistoryEntry is one deduplicated command line from the command history
+type HistoryEntry struct {
+	Cmd   string    `json:"cmd"`
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// HistoryReader provides read-only access to the command history,
+// most relevant entries first
+type HistoryReader interface {
+	Ranked() []HistoryEntry
+}
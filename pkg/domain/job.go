@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+// JobStatus is where a background job is in its life
+type JobStatus int
+
+const (
+	JobRunning JobStatus = iota
+	JobDone
+	JobFailed
+	JobCanceled
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// Job is a snapshot of a command running in the background, see
+// Command.Background
+type Job struct {
+	ID       int
+	Command  string
+	Started  time.Time
+	Finished time.Time
+	Status   JobStatus
+	// Output of everything the job ran, then its result message
+	Output string
+	Err    error
+}
+
+// Done reports whether the job has finished, one way or another
+func (j Job) Done() bool {
+	return j.Status != JobRunning
+}
+
+// Duration is how long the job ran, or has been running
+func (j Job) Duration() time.Duration {
+	if j.Finished.IsZero() {
+		return time.Since(j.Started)
+	}
+	return j.Finished.Sub(j.Started)
+}
+
+// JobControl lists and controls background jobs, newest first
+type JobControl interface {
+	Jobs() []Job
+	Job(id int) (Job, bool)
+	Cancel(id int) error
+	// Wait blocks until the job is done
+	Wait(id int) (Job, error)
+}
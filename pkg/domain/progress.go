@@ -0,0 +1,87 @@
+package domain
+
+import "time"
+
+// Progress is one update from a running command, see Ctx.Progress
+type Progress struct {
+	// Command line that reports, and its job when it runs in the background
+	Command string
+	Job     int
+	// Sub-task the update is about, empty for the command as a whole
+	Task string
+	// 0 to 100, negative while there is no way to tell, see Indeterminate
+	Percent float64
+	// What is happening now
+	Step string
+	// The command or sub-task finished
+	Done bool
+	At   time.Time
+}
+
+// Indeterminate updates are shown as a spinner instead of a bar
+func (p Progress) Indeterminate() bool {
+	return p.Percent < 0
+}
+
+// ProgressReporter sends progress updates of a command to the engine. A nil
+// reporter discards them, so handlers can report unconditionally.
+type ProgressReporter struct {
+	base Progress
+	sink func(Progress)
+}
+
+func NewProgressReporter(sink func(Progress)) *ProgressReporter {
+	return &ProgressReporter{sink: sink}
+}
+
+// For returns a reporter for a command line, and its job if it has one
+func (r *ProgressReporter) For(command string, job int) *ProgressReporter {
+	if r == nil {
+		return nil
+	}
+	out := *r
+	out.base.Command, out.base.Job = command, job
+	return &out
+}
+
+// Set reports percent done, clamped to 0..100, with the current step
+func (r *ProgressReporter) Set(percent float64, step string) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	r.send(percent, step, false)
+}
+
+// Spin reports a step of unknown length
+func (r *ProgressReporter) Spin(step string) {
+	r.send(-1, step, false)
+}
+
+// Task returns a reporter for a named sub-task of the command
+func (r *ProgressReporter) Task(name string) *ProgressReporter {
+	if r == nil {
+		return nil
+	}
+	out := *r
+	if out.base.Task != "" {
+		name = out.base.Task + "/" + name
+	}
+	out.base.Task = name
+	return &out
+}
+
+// Done reports the end of the command or sub-task
+func (r *ProgressReporter) Done() {
+	r.send(100, "", true)
+}
+
+func (r *ProgressReporter) send(percent float64, step string, done bool) {
+	if r == nil || r.sink == nil {
+		return
+	}
+	p := r.base
+	p.Percent, p.Step, p.Done, p.At = percent, step, done, time.Now()
+	r.sink(p)
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/tmpl"
 	"github.com/ourorg/goui/pkg/util"
 )
 
@@ -27,8 +29,46 @@ type State struct {
 	CacheTTLSeconds int       // 0 for no caching, N seconds for cache validity
 	ComputedAt      time.Time // When the state data was last computed
 
-	// Optional selection handler for later
+	// Called with the entry ID (list item Main) when a row is activated
 	OnSelect func(item string)
+
+	// Optional state an activated row opens, see Engine.Activate
+	DrillDown *DrillDown
+
+	// Log name templates that use missing args instead of showing "<no value>"
+	StrictNames bool
+
+	// Env, dir, stdin and limits for commands run in this state
+	ExecOptions execx.Options
+}
+
+// DrillDown maps an activated entry to the args of a child state, e.g.
+// Args: {"pod": "{{index .Values 0}}"} or {"pod": "{{.Cols.Name}}"}.
+// Templates see the entry .ID, its .Values and .Cols keyed by header.
+type DrillDown struct {
+	Target int
+	Args   map[string]string
+}
+
+// Render executes the arg templates for one entry. Templates are strict,
+// naming a column the table does not have is an error.
+func (d *DrillDown) Render(id string, headers, values []string) (map[string]interface{}, error) {
+	cols := map[string]string{}
+	for i, h := range headers {
+		if i < len(values) {
+			cols[h] = values[i]
+		}
+	}
+	data := map[string]interface{}{"ID": id, "Values": values, "Cols": cols}
+	args := make(map[string]interface{}, len(d.Args))
+	for k, t := range d.Args {
+		v, err := util.RenderTemplate(t, data, tmpl.Strict)
+		if err != nil {
+			return nil, fmt.Errorf("drill-down arg %s: %w", k, err)
+		}
+		args[k] = v
+	}
+	return args, nil
 }
 
 // Display layout constants
@@ -68,7 +108,7 @@ func LayoutKindToString(t int) string {
 }
 
 func (s *State) ShortName() string {
-	name := util.ProcessTemplate(s.ShortNameTmpl, s.Args)
+	name := s.renderName(s.ShortNameTmpl)
 	logrus.Debugf("Generated short name for state %d: %s", s.ID, name)
 	return name
 }
@@ -77,11 +117,23 @@ func (s *State) LongName() string {
 	if s.LongNameTmpl == "" {
 		s.LongNameTmpl = s.ShortNameTmpl
 	}
-	name := util.ProcessTemplate(s.LongNameTmpl, s.Args)
+	name := s.renderName(s.LongNameTmpl)
 	logrus.Debugf("Generated long name for state %d: %s", s.ID, name)
 	return name
 }
 
+func (s *State) renderName(t string) string {
+	if !s.StrictNames {
+		return util.ProcessTemplate(t, s.Args)
+	}
+	name, err := util.RenderTemplate(t, s.Args, tmpl.Strict)
+	if err != nil {
+		logrus.Errorf("State %d name %q: %v", s.ID, t, err)
+		return t
+	}
+	return name
+}
+
 func GetStateByID(states []State, id int) (*State, error) {
 	for _, state := range states {
 		if state.ID == id {
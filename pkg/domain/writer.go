@@ -4,6 +4,10 @@ package domain
 // This is duplicated from service package to avoid import cycles
 type StateWriter interface {
 	SetNextState(id int, mutateArgs func(map[string]interface{})) error
-	Push(id int) error
+	// UpdateArgs changes the current state's args without a transition
+	UpdateArgs(mutateArgs func(map[string]interface{})) error
+	// Push opens a state on top of the navigation stack, Pop returns to the
+	// state below it with the args it had
+	Push(id int, mutateArgs func(map[string]interface{})) error
 	Pop() error
 }
\ No newline at end of file
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"github.com/ourorg/goui/pkg/audit"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/service"
+)
+
+// Audit is the log of executed commands, nil unless Options.AuditPath is set.
+func (e *Engine) Audit() *audit.Log {
+	return e.audit
+}
+
+// auditEnv is the host of the executor built from cfg and the state a
+// command runs from, asked for at the time it runs, maybe by a background
+// job, so neither reads engine data under its lock.
+func (e *Engine) auditEnv(cfg execx.Config) func() audit.Env {
+	host := cfg.Target()
+	return func() audit.Env {
+		name, _ := e.stateName.Load().(string)
+		return audit.Env{Host: host, State: name}
+	}
+}
+
+// trackStateName keeps the name of the current state for auditEnv.
+func (e *Engine) trackStateName(c service.StateChange) {
+	if c.To != nil {
+		e.stateName.Store(c.To.ShortName())
+	}
+}
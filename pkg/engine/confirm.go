@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// maxPreview bounds the rendered commands a prompt lists for bulk commands.
+const maxPreview = 3
+
+// Confirmation is a dangerous command waiting for the user's answer.
+// UIs show Prompt and pass the typed answer to Engine.Confirm.
+type Confirmation struct {
+	Alias  string
+	Args   []string
+	Danger domain.Danger
+
+	// Fully rendered command, one per selected entry for bulk commands
+	Commands []string
+	// Where the command runs, see execx.Config.Target
+	Target    string
+	Selection []string
+	// Answer required for DangerHigh, y/yes is enough otherwise
+	Word string
+
+	// State the prompt was made in, see Engine.stale
+	stateID int
+}
+
+// Prompt describes what is about to run and how to confirm it.
+func (c *Confirmation) Prompt() string {
+	var b strings.Builder
+	verb := "Run"
+	if c.Danger == domain.DangerHigh {
+		verb = "DANGER: run"
+	}
+	fmt.Fprintf(&b, "%s %q", verb, c.Commands[0])
+	if n := len(c.Commands); n > 1 {
+		shown := c.Commands[1:]
+		if len(shown) > maxPreview-1 {
+			shown = shown[:maxPreview-1]
+		}
+		for _, cmd := range shown {
+			fmt.Fprintf(&b, ", %q", cmd)
+		}
+		if more := n - 1 - len(shown); more > 0 {
+			fmt.Fprintf(&b, " and %d more", more)
+		}
+	}
+	fmt.Fprintf(&b, " on %s", c.Target)
+	if len(c.Selection) > 0 {
+		fmt.Fprintf(&b, " for %d selected", len(c.Selection))
+	}
+	if c.Danger == domain.DangerHigh {
+		fmt.Fprintf(&b, ". Type %q to confirm", c.Word)
+	} else {
+		b.WriteString("? [y/N]")
+	}
+	return b.String()
+}
+
+// Accepts reports whether the typed answer confirms the command.
+func (c *Confirmation) Accepts(input string) bool {
+	input = strings.TrimSpace(input)
+	if c.Danger == domain.DangerHigh {
+		return input == c.Word
+	}
+	switch strings.ToLower(input) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// Pending returns the command waiting for confirmation, nil if none.
+func (e *Engine) Pending() *Confirmation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pending
+}
+
+// Confirm answers the pending confirmation, running the command when the
+// answer is accepted and dropping it otherwise.
+func (e *Engine) Confirm(input string) (string, spec.Spec, error) {
+	defer e.enter()()
+	c := e.pending
+	if c == nil {
+		err := errors.New("nothing to confirm")
+		return "Error: " + err.Error(), e.renderSpec(), err
+	}
+	e.pending = nil
+	if !c.Accepts(input) {
+		return "Cancelled " + c.Alias, e.renderSpec(), nil
+	}
+	if err := e.stale(c); err != nil {
+		return "Error: " + err.Error(), e.renderSpec(), err
+	}
+	if cmd, ok := e.commandService.Resolve(c.Alias); ok {
+		if err := e.checkReadOnly(cmd, c.Alias); err != nil {
+			return "Error: " + err.Error(), e.renderSpec(), err
+		}
+	}
+	return e.dispatch(c.Alias, c.Args)
+}
+
+// Cancel drops the pending confirmation.
+func (e *Engine) Cancel() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = nil
+}
+
+// SetReadOnly turns read-only mode on or off, see Options.ReadOnly.
+func (e *Engine) SetReadOnly(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.readOnly = on
+}
+
+func (e *Engine) ReadOnly() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.readOnly
+}
+
+func (e *Engine) checkReadOnly(cmd *domain.Command, alias string) error {
+	if e.readOnly && cmd.IsMutating() {
+		return fmt.Errorf("read-only mode, %s is not allowed", alias)
+	}
+	return nil
+}
+
+// stale reports why c no longer describes what would run: the user moved
+// to another state, changed the selection or switched the exec target while
+// the prompt was open.
+func (e *Engine) stale(c *Confirmation) error {
+	ctx := NewCtxBuilder(e, nil)()
+	switch {
+	case ctx.CurrentStateID != c.stateID:
+		return fmt.Errorf("not running %s, the view changed since the prompt, run it again", c.Alias)
+	case !sameStrings(ctx.Selection, c.Selection):
+		return fmt.Errorf("not running %s, the selection changed since the prompt, run it again", c.Alias)
+	case e.confirmTarget() != c.Target:
+		return fmt.Errorf("not running %s, the target changed since the prompt, run it again", c.Alias)
+	}
+	return nil
+}
+
+// confirmTarget names where a confirmed command would run.
+func (e *Engine) confirmTarget() string {
+	t := e.execCfg.Target()
+	if e.dryRun {
+		t += " (dry run)"
+	}
+	return t
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) newConfirmation(cmd *domain.Command, alias string, args []string) *Confirmation {
+	ctx := NewCtxBuilder(e, nil)()
+	c := &Confirmation{
+		Alias:     alias,
+		Args:      args,
+		Danger:    cmd.Danger,
+		Target:    e.confirmTarget(),
+		Selection: ctx.Selection,
+		Word:      cmd.ConfirmationWord(),
+		stateID:   ctx.CurrentStateID,
+	}
+	render := func() string {
+		if cmd.CmdTmpl == "" || cmd.Sensitive {
+			return secret.Redact(cmd.Line(alias, args))
+		}
+		r, err := execx.RenderCommand(cmd.CmdTmpl, ctx.TemplateData(args), e.execCfg.ShellMode)
+		if err != nil {
+			return cmd.CmdTmpl
+		}
+		return secret.Redact(r.Line)
+	}
+	if cmd.Bulk && len(ctx.Selection) > 0 && !cmd.Sensitive {
+		for _, id := range ctx.Selection {
+			ctx.Target = id
+			c.Commands = append(c.Commands, render())
+		}
+	} else {
+		c.Commands = []string{render()}
+	}
+	return c
+}
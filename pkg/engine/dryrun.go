@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// SetDryRun switches between running commands and recording what would
+// run, keeping the exec config so dry runs show the real ssh wrapping.
+func (e *Engine) SetDryRun(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dryRun = on
+	e.resetExecutor()
+}
+
+func (e *Engine) DryRun() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dryRun
+}
+
+// resetExecutor builds the executor for execCfg, or its dry-run preview,
+// wrapped in the middleware.
+func (e *Engine) resetExecutor() {
+	var base execx.Executor
+	if e.dryRun {
+		base = execx.NewDryRun(e.execCfg)
+	} else {
+		base = newExecutor(e.execCfg)
+	}
+	e.recorder, _ = base.(execx.Recorder)
+	// redaction innermost, so every middleware and the audit log see
+	// masked results
+	mws := append([]execx.Middleware{}, e.mws...)
+	if e.audit != nil {
+		mws = append(mws, e.audit.Middleware(e.auditEnv(e.execCfg)))
+	}
+	mws = append(mws, e.execEvents())
+	mws = append(mws, execx.Redact(secret.Redact))
+	e.executor = execx.Chain(base, mws...)
+	e.execMode = e.execCfg.Mode
+}
+
+// Use appends middleware and rebuilds the executor with it.
+func (e *Engine) Use(mws ...execx.Middleware) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mws = append(e.mws, mws...)
+	e.resetExecutor()
+}
+
+// dryRunSpec previews the recorded commands, rendered line first and the
+// process argv below it.
+func dryRunSpec(ran []execx.Result) spec.Spec {
+	var b strings.Builder
+	for i, r := range ran {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if r.Command != "" {
+			fmt.Fprintf(&b, "%s\n", r.Command)
+		}
+		fmt.Fprintf(&b, "  $ %s\n", execx.QuoteArgv(r.Argv))
+	}
+	return spec.Spec{
+		Kind: spec.KindText,
+		Text: &spec.Text{
+			Title: fmt.Sprintf("Dry run: %d command(s)", len(ran)),
+			Body:  b.String(),
+		},
+	}
+}
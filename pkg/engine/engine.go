@@ -1,10 +1,21 @@
 package engine
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/audit"
 	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/event"
 	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
 	"github.com/ourorg/goui/pkg/service"
 	"github.com/ourorg/goui/pkg/spec"
 )
@@ -13,9 +24,63 @@ type Options struct {
 	Info       func(string)
 	ExecMode   execx.Mode
 	ExecConfig execx.Config
+
+	// Session persistence, disabled when SessionPath is empty.
+	SessionPath string
+	// Periodic snapshot interval, 0 only saves on Close.
+	SessionInterval time.Duration
+	// Skip restoring the saved session, see WantsFresh.
+	FreshSession bool
+
+	// Command history file shared by all instances, empty keeps it in memory.
+	HistoryPath string
+	// Distinct command lines kept, 0 uses service.DefaultHistoryMax.
+	HistoryMax int
+
+	// Refuse mutating commands, can be changed later with SetReadOnly.
+	ReadOnly bool
+	// Record commands instead of running them, see SetDryRun. An
+	// ExecConfig with execx.ModeDryRun turns it on as well.
+	DryRun bool
+
+	// Named targets for UseProfile and the exec builtin, e.g. "prod" for
+	// an ssh host with its options.
+	Profiles map[string]execx.Config
+
+	// Wrapped around every executor the engine builds, first outermost,
+	// e.g. execx.Logging(nil).
+	Middleware []execx.Middleware
+
+	// Tamper-evident log of every command run, disabled when empty, see
+	// package audit.
+	AuditPath string
+	// Size and rotation of the audit log, 0 uses the audit defaults.
+	AuditMaxSize int64
+	AuditKeep    int
+
+	// Least time between progress updates of one command that reach
+	// OnProgress subscribers, 0 uses DefaultProgressInterval.
+	ProgressInterval time.Duration
+}
+
+// FreshFlag is the command line escape hatch that starts without the saved session.
+const FreshFlag = "--fresh"
+
+// WantsFresh reports whether FreshFlag is among the given command line args.
+func WantsFresh(args []string) bool {
+	for _, a := range args {
+		if a == FreshFlag {
+			return true
+		}
+	}
+	return false
 }
 
 type Engine struct {
+	// serializes dispatch, see enter
+	mu    sync.Mutex
+	scope context.Context
+
 	// registries
 	stateReg   *service.StateRegistry
 	modeReg    *service.ModeRegistry
@@ -28,11 +93,38 @@ type Engine struct {
 	commandService service.CommandProvider
 
 	// execution
+	execCfg  execx.Config
 	execMode execx.Mode
 	executor execx.Executor
+	dryRun   bool
+	recorder execx.Recorder
+	mws      []execx.Middleware
+	audit    *audit.Log
+	profiles map[string]execx.Config
+	profile  string
+	// switch requested by a running command, see requestExec
+	nextExec *execx.Config
+	// nested dispatches, e.g. rerun, share the outer dry-run preview
+	dispatching int
 
 	// info sink
-	info func(string)
+	infoMu sync.Mutex
+	info   func(string)
+	// name of the current state for the audit log, see trackStateName
+	stateName atomic.Value
+	// progress of running commands, see OnProgress
+	progress *progressHub
+	// lifecycle and state changes, see Subscribe
+	events *event.Bus
+
+	// session persistence
+	session     *service.SessionStore
+	stopSession chan struct{}
+	autosaved   chan struct{} // closed when autosave returned
+
+	// safety gates
+	readOnly bool
+	pending  *Confirmation
 }
 
 func New(
@@ -54,6 +146,9 @@ func New(
 		modeService:    md,
 		commandService: cp,
 		info:           opts.Info,
+		progress:       newProgressHub(opts.ProgressInterval),
+		events:         event.NewBus(),
+		readOnly:       opts.ReadOnly,
 	}
 
 	// executor
@@ -65,30 +160,83 @@ func New(
 			cfg.Mode = execx.ModeDemo
 		}
 	}
-	switch cfg.Mode {
-	case execx.ModeLocal:
-		e.executor = execx.NewLocal(cfg)
-	case execx.ModeSSH:
-		e.executor = execx.NewSSH(cfg)
-	default:
-		e.executor = execx.NewDemo(cfg)
+	e.dryRun = opts.DryRun
+	if c, dry := splitDryRun(cfg); dry {
+		cfg, e.dryRun = c, true
+	}
+	e.execCfg = cfg
+	e.mws = opts.Middleware
+	// a copy, the app's map may change under a running engine
+	e.profiles = make(map[string]execx.Config, len(opts.Profiles))
+	for name, p := range opts.Profiles {
+		e.profiles[name] = p
+	}
+	e.profile = e.profileOf(cfg)
+	if opts.AuditPath != "" {
+		log, err := audit.Open(opts.AuditPath, audit.Options{MaxSize: opts.AuditMaxSize, Keep: opts.AuditKeep})
+		if err != nil {
+			logrus.Errorf("Failed to open audit log %s: %v", opts.AuditPath, err)
+		} else {
+			e.audit = log
+		}
 	}
-	e.execMode = cfg.Mode
+	e.resetExecutor()
+
+	// keep resolved secrets out of log output
+	secret.InstallHook(logrus.StandardLogger())
 
 	// wire SetInfo on commands
 	for _, c := range cr.Index() {
 		c.SetInfo = func(msg string) {
-			if e.info != nil {
-				e.info(msg)
-			}
+			e.notify(secret.Redact(msg))
+		}
+	}
+
+	// background jobs report when they finish
+	e.commandService.Jobs().SetNotify(func(msg string) {
+		e.notify(secret.Redact(msg))
+	})
+
+	// command history
+	if opts.HistoryPath != "" {
+		if err := e.commandService.History().Open(opts.HistoryPath, opts.HistoryMax); err != nil {
+			logrus.Warnf("Failed to open command history %s: %v", opts.HistoryPath, err)
 		}
 	}
 
 	// init state
+	e.stateService.OnChange(e.publishState)
+	e.stateService.OnChange(e.trackStateName)
 	_ = e.stateService.Init(firstStateID(sr))
+
+	// session
+	if opts.SessionPath != "" {
+		e.session = service.NewSessionStore(opts.SessionPath)
+		if !opts.FreshSession {
+			e.restoreSession(opts.ExecConfig.Mode != 0 || opts.ExecMode != 0)
+		}
+		if opts.SessionInterval > 0 {
+			e.stopSession = make(chan struct{})
+			e.autosaved = make(chan struct{})
+			go e.autosave(opts.SessionInterval, e.stopSession, e.autosaved)
+		}
+	}
 	return e
 }
 
+func newExecutor(cfg execx.Config) execx.Executor {
+	switch cfg.Mode {
+	case execx.ModeLocal:
+		return execx.NewLocal(cfg)
+	case execx.ModeSSH:
+		return execx.NewSSH(cfg)
+	case execx.ModeDryRun:
+		return execx.NewDryRun(cfg)
+	default:
+		return execx.NewDemo(cfg)
+	}
+}
+
 func firstStateID(sr *service.StateRegistry) int {
 	idx := sr.Index()
 	min := int(^uint(0) >> 1) // max int
@@ -103,57 +251,237 @@ func firstStateID(sr *service.StateRegistry) int {
 	return min
 }
 
+// errNoState is returned when the engine has no current state to act on,
+// e.g. its registry has no states.
+var errNoState = errors.New("no current state")
+
+// CurrentState returns a copy of the current state, args included, which
+// the caller may keep or change without affecting the engine.
 func (e *Engine) CurrentState() *domain.State {
-	return e.stateService.Current()
+	st := e.stateService.Current()
+	if st == nil {
+		return nil
+	}
+	cp := *st
+	cp.Args = make(map[string]interface{}, len(st.Args))
+	for k, v := range st.Args {
+		cp.Args[k] = v
+	}
+	return &cp
 }
 
+// SetInfo sets the info sink. It is called from any goroutine, sometimes
+// with the engine locked, and must not call back into the engine.
 func (e *Engine) SetInfo(fn func(string)) {
+	e.infoMu.Lock()
 	e.info = fn
+	e.infoMu.Unlock()
 }
 
+// BuildSpec builds the current state's spec and reports pipeline problems,
+// like a bad search query, to the info sink.
 func (e *Engine) BuildSpec() spec.Spec {
-	return e.specService.BuildSpec(e.CurrentState())
+	defer e.enter()()
+	return e.renderSpec()
 }
 
-// StateCtrl exposes a writer view for UIs and commands.
-func (e *Engine) StateCtrl() domain.StateWriter {
-	return stateWriter{e.stateService}
+// renderSpec is BuildSpec for callers holding the lock.
+func (e *Engine) renderSpec() spec.Spec {
+	sp := e.buildSpec()
+	if sp.Info != "" {
+		e.notify(sp.Info)
+	}
+	out := sp
+	e.events.Publish(event.Event{Kind: event.SpecRebuilt, Spec: &out})
+	return sp
+}
+
+func (e *Engine) buildSpec() spec.Spec {
+	st := e.stateService.Current()
+	sp := e.specService.BuildSpec(st)
+	if st != nil {
+		sp = e.specService.ApplyFilter(sp, st.Args)
+	}
+	sp.Breadcrumbs = e.stateService.Breadcrumbs()
+	sp.Status = e.status()
+	return redactSpec(sp)
+}
+
+// Activate handles Enter on the table entry or list item with the given ID:
+// the state's OnSelect runs, then its DrillDown, if any, opens the child
+// state on the navigation stack with args taken from the entry.
+func (e *Engine) Activate(id string) (string, spec.Spec, error) {
+	defer e.enter()()
+	st := e.stateService.Current()
+	if st == nil {
+		return "", e.renderSpec(), errNoState
+	}
+	var headers, values []string
+	found := false
+	sp := e.buildSpec()
+	switch {
+	case sp.Table != nil:
+		headers = sp.Table.Headers
+		for _, en := range sp.Table.Entries {
+			if en.ID == id {
+				values, found = en.Values, true
+				break
+			}
+		}
+	case sp.List != nil:
+		headers = []string{"Main", "Secondary"}
+		for _, it := range sp.List.Items {
+			if it.Main == id {
+				values, found = []string{it.Main, it.Secondary}, true
+				break
+			}
+		}
+	}
+	if !found {
+		err := fmt.Errorf("no entry %q in this view", id)
+		return "Error: " + err.Error(), sp, err
+	}
+
+	if st.OnSelect != nil {
+		st.OnSelect(id)
+	}
+	dd := st.DrillDown
+	if dd == nil {
+		return "Selected " + id, e.renderSpec(), nil
+	}
+	args, err := dd.Render(id, headers, values)
+	if err != nil {
+		return "Error: " + err.Error(), e.renderSpec(), err
+	}
+	if err := e.stateService.Push(dd.Target, func(a map[string]interface{}) {
+		for k, v := range args {
+			a[k] = v
+		}
+		// a new drill-down starts unfiltered on its first page
+		delete(a, service.ArgSearchTerm)
+		delete(a, "searchActive")
+		delete(a, service.ArgOffset)
+		delete(a, service.ArgSelection)
+	}); err != nil {
+		return "Error: " + err.Error(), e.renderSpec(), err
+	}
+	return e.arrived("Opened ")
 }
 
-type stateWriter struct {
-	s service.StateProvider
+// Back returns from a drill-down to the parent state.
+func (e *Engine) Back() (string, spec.Spec, error) {
+	defer e.enter()()
+	if err := e.stateService.Pop(); err != nil {
+		return "Error: " + err.Error(), e.renderSpec(), err
+	}
+	return e.arrived("Back to ")
 }
 
-func (w stateWriter) SetNextState(id int, mutateArgs func(map[string]interface{})) error {
-	return w.s.SetNextState(id, mutateArgs)
+// arrived names the state a navigation ended in after prefix.
+func (e *Engine) arrived(prefix string) (string, spec.Spec, error) {
+	st := e.stateService.Current()
+	if st == nil {
+		return "Error: " + errNoState.Error(), e.renderSpec(), errNoState
+	}
+	return prefix + st.ShortName(), e.renderSpec(), nil
 }
 
-func (w stateWriter) Push(id int) error {
-	return w.s.Push(id)
+// Breadcrumbs names the drill-down path to the current state.
+func (e *Engine) Breadcrumbs() []string {
+	return e.stateService.Breadcrumbs()
 }
 
-func (w stateWriter) Pop() error {
-	return w.s.Pop()
+// Scroll moves the window of a source backed table or list by delta rows,
+// fetching the next page once the user scrolls past the loaded one.
+func (e *Engine) Scroll(delta int) spec.Spec {
+	defer e.enter()()
+	sp := e.buildSpec()
+	var w *spec.Window
+	switch {
+	case sp.Table != nil:
+		w = sp.Table.Window
+	case sp.List != nil:
+		w = sp.List.Window
+	}
+	if w == nil || delta == 0 {
+		return sp
+	}
+	offset := service.ClampOffset(w.Offset+delta, w)
+	if offset == w.Offset {
+		return sp
+	}
+	_ = e.stateService.UpdateArgs(func(a map[string]interface{}) {
+		a[service.ArgOffset] = offset
+	})
+	return e.renderSpec()
 }
 
 func (e *Engine) Execute(alias string, args []string) (string, spec.Spec, error) {
+	defer e.enter()()
+	return e.execute(alias, args)
+}
+
+// execute is Execute for callers holding the lock, e.g. Ctx.Dispatch.
+func (e *Engine) execute(alias string, args []string) (string, spec.Spec, error) {
 	if alias == "" {
-		return "", e.BuildSpec(), errors.New("empty command")
+		return "", e.renderSpec(), errors.New("empty command")
+	}
+
+	// Safety gates: read-only mode, then confirmation of dangerous commands
+	if cmd, ok := e.commandService.Resolve(alias); ok {
+		if err := e.checkReadOnly(cmd, alias); err != nil {
+			return "Error: " + err.Error(), e.renderSpec(), err
+		}
+		if cmd.Danger != domain.DangerNone {
+			e.pending = e.newConfirmation(cmd, alias, args)
+			return e.pending.Prompt(), e.renderSpec(), nil
+		}
+	}
+	return e.dispatch(alias, args)
+}
+
+// dispatch runs a command that passed the safety gates.
+func (e *Engine) dispatch(alias string, args []string) (string, spec.Spec, error) {
+	rec := e.recorder
+	if rec != nil && e.dispatching == 0 {
+		rec.Recorded() // drop what ran outside of commands
 	}
+	e.dispatching++
 
 	// Delegate to CommandService for dispatch
+	start := time.Now()
 	msg, err := e.commandService.Dispatch(alias, args)
+	e.dispatching--
+	if e.dispatching == 0 {
+		e.applyPendingExec()
+	}
 	if msg == "" && err != nil {
 		msg = "Error: " + err.Error()
 	}
 
-	// Handle mode/state transitions through providers
-	if cmd, ok := e.commandService.Resolve(alias); ok && cmd.IsAvailable(e.CurrentState().ID) {
-		next := cmd.NextState(e.CurrentState().ID)
-		_ = e.stateService.SetNextState(next, nil)
+	// Handle mode/state transitions through providers, bulk commands
+	// already moved to their results
+	line := strings.Join(append([]string{alias}, args...), " ")
+	if cmd, ok := e.commandService.Resolve(alias); ok {
+		switch curr := e.stateService.Current(); {
+		case curr == nil:
+			if err == nil {
+				err = errNoState
+				msg = "Error: " + err.Error()
+			}
+		case !cmd.Bulk && cmd.IsAvailable(curr.ID):
+			_ = e.stateService.SetNextState(cmd.NextState(curr.ID), nil)
+		}
+		line = cmd.Line(alias, args)
 	}
+	e.publishDispatch(line, msg, err, time.Since(start))
 
-	return msg, e.BuildSpec(), err
+	if rec != nil && e.dispatching == 0 {
+		if ran := rec.Recorded(); len(ran) > 0 {
+			return secret.Redact(msg), redactSpec(dryRunSpec(ran)), redactErr(err)
+		}
+	}
+	return secret.Redact(msg), e.renderSpec(), redactErr(err)
 }
 
 func (e *Engine) Suggestions(prefix string) []string {
@@ -164,8 +492,20 @@ func (e *Engine) Autocomplete(prefix string) []string {
 	return e.commandService.Autocomplete(prefix)
 }
 
+// ReverseSearch returns the skip-th most recent history line containing query,
+// backing a Ctrl-R style prompt.
+func (e *Engine) ReverseSearch(query string, skip int) (string, bool) {
+	entry, ok := e.commandService.History().ReverseSearch(query, skip)
+	return entry.Cmd, ok
+}
+
 func (e *Engine) SetMode(m int) {
+	defer e.enter()()
+	from := e.modeService.CurrentMode()
 	e.modeService.SetMode(m)
+	if from != m {
+		e.events.Publish(event.Event{Kind: event.ModeChanged, FromMode: from, ToMode: m})
+	}
 }
 
 func (e *Engine) CurrentMode() int {
@@ -174,15 +514,20 @@ func (e *Engine) CurrentMode() int {
 
 // Expose executor for context building
 func (e *Engine) Executor() execx.Executor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.executor
 }
 
 func (e *Engine) ExecMode() execx.Mode {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.execMode
 }
 
 // Undo/redo operations for TODO19 architecture
 func (e *Engine) Undo() bool {
+	defer e.enter()()
 	if e.stateService.Undo() {
 		return true
 	}
@@ -190,27 +535,87 @@ func (e *Engine) Undo() bool {
 }
 
 func (e *Engine) Redo() bool {
+	defer e.enter()()
 	if e.stateService.Redo() {
 		return true
 	}
 	return false
 }
 
-
-// Context builder helper for CommandService wiring.
+// Context builder helper for CommandService wiring. It is called with the
+// engine locked, the Ctx callbacks run inline or lock, see inlineFor.
 func NewCtxBuilder(e *Engine, regReader domain.RegistryReader) func() *domain.Ctx {
 	return func() *domain.Ctx {
-		currState := e.CurrentState()
+		currState := e.stateService.Current()
 		stateID := 0
+		var selection []string
+		var stateArgs map[string]interface{}
+		executor := e.executor
 		if currState != nil {
 			stateID = currState.ID
+			// a copy, background jobs read it while the state moves on
+			stateArgs = make(map[string]interface{}, len(currState.Args))
+			for k, v := range currState.Args {
+				stateArgs[k] = v
+			}
+			executor = execx.WithOptions(executor, currState.ExecOptions)
+			if sel, ok := currState.Args[service.ArgSelection].([]string); ok {
+				selection = append(selection, sel...)
+			}
 		}
-		return &domain.Ctx{
+		ctx := &domain.Ctx{
 			CurrentStateID: stateID,
 			Registry:       regReader,
-			Exec:           e.executor,
+			Exec:           executor,
 			ExecMode:       e.execMode,
-			State:          e.StateCtrl(),
+			ExecConfig:     e.execCfg,
+			History:        e.commandService.History(),
+			StateArgs:      stateArgs,
+			Selection:      selection,
+			ExecProfiles:   e.profiles,
+			Audit:          e.audit,
+			Jobs:           e.commandService.Jobs(),
+			Context:        context.Background(),
+			Progress:       domain.NewProgressReporter(e.progress.publish),
+		}
+		if e.scope != nil {
+			ctx.Context = e.scope
+		}
+		inline := e.inlineFor(func() context.Context { return ctx.Context })
+		ctx.State = stateWriter{e: e, inline: inline}
+		ctx.Dispatch = func(line string) (string, error) {
+			alias, args := domain.ParseInput(line)
+			var msg string
+			err := e.guard(inline, func() (err error) {
+				msg, _, err = e.execute(alias, args)
+				return err
+			})
+			return msg, err
 		}
+		ctx.Spec = func() spec.Spec {
+			var sp spec.Spec
+			_ = e.guard(inline, func() error {
+				sp = e.buildSpec()
+				return nil
+			})
+			return sp
+		}
+		ctx.SetExecMode = func(mode execx.Mode, cfg execx.Config) error {
+			return e.guard(inline, func() error { return e.requestExec(mode, cfg) })
+		}
+		ctx.Blocking = func(wait func()) {
+			if !inline() {
+				wait()
+				return
+			}
+			scope := e.scope
+			e.mu.Unlock()
+			defer func() {
+				e.mu.Lock()
+				e.scope = scope
+			}()
+			wait()
+		}
+		return ctx
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/event"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/service"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	e := openTestEngine(t, t.TempDir())
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// openTestEngine keeps its session and history in dir, so a second engine
+// on the same dir restores what the first one saved on Close.
+func openTestEngine(t *testing.T, dir string) *Engine {
+	t.Helper()
+	return openTestEngineWith(t, dir, execx.Config{Mode: execx.ModeDemo})
+}
+
+func openTestEngineWith(t *testing.T, dir string, cfg execx.Config) *Engine {
+	t.Helper()
+	reg := service.NewRegistry()
+	reg.AddStates(
+		domain.State{ID: 0, ShortNameTmpl: "Home", LayoutKind: domain.DisplayText, Args: map[string]interface{}{}},
+		domain.State{ID: 1, ShortNameTmpl: "Pods {{.ns}}", LayoutKind: domain.DisplayTable, Args: map[string]interface{}{}},
+		domain.State{ID: 2, ShortNameTmpl: "Namespaces", LayoutKind: domain.DisplayTable,
+			DrillDown: &domain.DrillDown{Target: 1, Args: map[string]string{"ns": "{{.Cols.Name}}"}},
+			Args: map[string]interface{}{
+				"headers": []string{"Name", "Status"},
+				"entries": []spec.Entry{{ID: "a", Values: []string{"kube-system", "Active"}}, {ID: "b", Values: []string{"default", "Active"}}},
+			}},
+	)
+	reg.AddCommands(
+		&domain.Command{Aliases: []string{"ns"}, FromStates: []int{domain.StateAny}, ToStates: []int{2}},
+		&domain.Command{Aliases: []string{"pods"}, FromStates: []int{domain.StateAny}, ToStates: []int{1}},
+		&domain.Command{Aliases: []string{"bg"}, Background: true, FromStates: []int{domain.StateAny}, ToStates: []int{domain.StateSame},
+			Handler: func(c *domain.Ctx, _ []string) (string, error) {
+				c.Exec.Run("true")
+				c.State.UpdateArgs(func(a map[string]interface{}) { a["touched"] = time.Now() })
+				_ = c.Spec()
+				return c.Dispatch("ns")
+			}},
+		&domain.Command{Aliases: []string{"feed"}, Bulk: true, Parallel: true, FromStates: []int{2}, ToStates: []int{domain.StateSame},
+			CmdTmpl: "cat", ExecOptions: execx.Options{Stdin: execx.StdinBytes([]byte("payload"))}},
+		&domain.Command{Aliases: []string{"leak"}, FromStates: []int{domain.StateAny}, ToStates: []int{domain.StateSame},
+			Handler: func(c *domain.Ctx, args []string) (string, error) {
+				c.State.UpdateArgs(func(a map[string]interface{}) {
+					a["entries"] = []spec.Entry{{ID: args[0], Values: []string{args[0], "x"}, Matches: [][]int{{0}, {0}}}}
+				})
+				return "", fmt.Errorf("bad value %s", args[0])
+			}},
+		&domain.Command{Aliases: []string{"hello"}, FromStates: []int{domain.StateAny}, ToStates: []int{domain.StateSame},
+			Handler: func(c *domain.Ctx, _ []string) (string, error) {
+				res, err := c.Exec.Run("echo", "hello")
+				return res.Stdout, err
+			}},
+	)
+	service.RegisterBuiltins(reg, nil, nil, nil)
+
+	var e *Engine
+	ss := service.NewStateService(service.NewDefaultStateStore(reg.StateRegistry()), reg.StateRegistry())
+	cs := service.NewCommandService(reg.CommandRegistry(), func() *domain.Ctx { return NewCtxBuilder(e, reg)() })
+	e = New(reg.StateRegistry(), reg.ModeRegistry(), reg.CommandRegistry(), service.NewSpecService(), ss,
+		service.NewModeService(reg.ModeRegistry()), cs, Options{
+			ExecConfig:      cfg,
+			Profiles:        map[string]execx.Config{"prod": {Mode: execx.ModeSSH, SSHHost: "prod1"}},
+			SessionPath:     filepath.Join(dir, "session.json"),
+			SessionInterval: 5 * time.Millisecond,
+			HistoryPath:     filepath.Join(dir, "history.jsonl"),
+			AuditPath:       filepath.Join(dir, "audit.jsonl"),
+		})
+	return e
+}
+
+func TestCurrentStateIsACopy(t *testing.T) {
+	e := newTestEngine(t)
+	e.Execute("ns", nil)
+	st := e.CurrentState()
+	st.Args["headers"] = []string{"Changed"}
+	st.ID = 99
+	if got := e.CurrentState(); got.ID != 2 || fmt.Sprint(got.Args["headers"]) != "[Name Status]" {
+		t.Errorf("changing the returned state changed the engine's: %d %v", got.ID, got.Args["headers"])
+	}
+}
+
+// Run with -race, a deadlock fails the test on its timeout.
+func TestConcurrentCallers(t *testing.T) {
+	e := newTestEngine(t)
+	e.SetInfo(func(string) {})
+	unsub := e.Subscribe(func(event.Event) {})
+	defer unsub()
+
+	work := []func(i int){
+		func(int) { e.Execute("ns", nil) },
+		func(int) { e.Execute("pods", nil) },
+		func(int) { e.BuildSpec() },
+		func(int) { e.Undo(); e.Redo() },
+		func(i int) { e.SetMode(i % 3); _ = e.CurrentMode() },
+		func(int) { _ = e.Status(); _ = e.Breadcrumbs(); _ = e.DryRun(); _ = e.Profiles() },
+		func(int) { e.Execute("bg", nil) },
+		func(int) { e.Execute("job", []string{"wait"}) },
+		func(int) { e.Execute("jobs", nil) },
+		func(int) { e.Activate("a"); e.Back() },
+		func(int) { e.Scroll(1) },
+		func(int) { _ = e.Suggestions("n"); _ = e.Autocomplete("j") },
+		func(int) {
+			if st := e.CurrentState(); st != nil {
+				st.Args["mine"] = true
+			}
+		},
+		func(int) { e.Execute("select", []string{"a"}); e.Execute("select-none", nil) },
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 40; i++ {
+				work[(g+i)%len(work)](i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	e.commandService.Jobs().CancelAll()
+	for _, j := range e.commandService.Jobs().Jobs() {
+		e.commandService.Jobs().Wait(j.ID)
+	}
+}
+
+func TestSessionRestoresDrillDown(t *testing.T) {
+	dir := t.TempDir()
+	e := openTestEngine(t, dir)
+	e.Execute("ns", nil)
+	if _, _, err := e.Activate("a"); err != nil {
+		t.Fatal(err)
+	}
+	want := e.Breadcrumbs()
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openTestEngine(t, dir)
+	defer e.Close()
+	if got := e.Breadcrumbs(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("breadcrumbs after restore = %q, want %q", got, want)
+	}
+	if got := e.CurrentState().Args["ns"]; got != "kube-system" {
+		t.Errorf("restored ns = %v, want kube-system", got)
+	}
+	if _, _, err := e.Back(); err != nil {
+		t.Fatalf("back after restore: %v", err)
+	}
+	if st := e.CurrentState(); st.ID != 2 || st.Args["entries"] == nil {
+		t.Errorf("back went to state %d with args %v, want the namespaces table", st.ID, st.Args)
+	}
+	// undo returns to the drill-down with its args, not the bare state
+	e.Undo()
+	if got := e.CurrentState().Args["ns"]; got != "kube-system" {
+		t.Errorf("ns after undo = %v, want kube-system", got)
+	}
+}
+
+func TestColumnCommandsUseAllHeaders(t *testing.T) {
+	e := newTestEngine(t)
+	e.Execute("ns", nil)
+	if _, _, err := e.Execute("columns", []string{"Status"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := e.Execute("col", []string{"hide", "Bogus"}); err == nil {
+		t.Error("hiding an unknown column should fail")
+	}
+	// Name is not shown, but it is a column of the state
+	if _, _, err := e.Execute("col", []string{"hide", "name"}); err != nil {
+		t.Errorf("hide a projected-out column: %v", err)
+	}
+	if _, _, err := e.Execute("col", []string{"move", "name", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.BuildSpec().Table.Headers; fmt.Sprint(got) != "[Name Status]" {
+		t.Errorf("headers after move = %q, want [Name Status]", got)
+	}
+	if _, _, err := e.Execute("col", []string{"move", "Status", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.BuildSpec().Table.Headers; fmt.Sprint(got) != "[Status Name]" {
+		t.Errorf("headers after second move = %q, want [Status Name]", got)
+	}
+}
+
+func TestDryRunModeRecords(t *testing.T) {
+	e := openTestEngineWith(t, t.TempDir(), execx.Config{Mode: execx.ModeDryRun})
+	defer e.Close()
+	if !e.DryRun() {
+		t.Error("ModeDryRun did not turn on dry run")
+	}
+	msg, sp, err := e.Execute("hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.Text == nil || !strings.Contains(sp.Text.Title, "Dry run: 1") || !strings.Contains(sp.Text.Body, "echo hello") {
+		t.Errorf("spec = %+v, want the recorded run", sp.Text)
+	}
+	if !strings.HasPrefix(msg, "dry-run: ") {
+		t.Errorf("message = %q, want the dry-run preview", msg)
+	}
+	if err := e.SetExec(execx.Config{Mode: execx.ModeDryRun, SSHHost: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, sp, _ := e.Execute("hello", nil); sp.Text == nil || !strings.Contains(sp.Text.Body, "ssh") {
+		t.Errorf("ssh dry run spec = %+v, want the ssh wrapping", sp.Text)
+	}
+}
+
+func TestParallelBulkGetsWholeStdin(t *testing.T) {
+	e := openTestEngineWith(t, t.TempDir(), execx.Config{Mode: execx.ModeLocal})
+	defer e.Close()
+	for run := 1; run <= 2; run++ {
+		e.Execute("ns", nil)
+		e.Execute("select", []string{"a", "b"})
+		if _, _, err := e.Execute("feed", nil); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		entries := e.BuildSpec().Table.Entries
+		if len(entries) != 2 {
+			t.Fatalf("run %d: %d results, want 2", run, len(entries))
+		}
+		for _, en := range entries {
+			if en.Values[1] != "ok" || en.Values[2] != "payload" {
+				t.Errorf("run %d: %s got %q", run, en.ID, en.Values[1:])
+			}
+		}
+	}
+}
+
+func TestRedactsErrorsKeepsIDs(t *testing.T) {
+	t.Setenv("GOUI_ENGINE_TEST_TOKEN", "tok-3141")
+	if _, err := secret.Lookup("env:GOUI_ENGINE_TEST_TOKEN"); err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEngine(t)
+	failed := make(chan event.Event, 1)
+	unsub := e.Subscribe(func(ev event.Event) {
+		if ev.Kind == event.CommandFailed {
+			failed <- ev
+		}
+	})
+	defer unsub()
+
+	e.Execute("ns", nil)
+	_, sp, err := e.Execute("leak", []string{"tok-3141"})
+	if err == nil || strings.Contains(err.Error(), "tok-3141") {
+		t.Errorf("returned error = %v, want it masked", err)
+	}
+	select {
+	case ev := <-failed:
+		if ev.Err == nil || strings.Contains(ev.Err.Error(), "tok-3141") {
+			t.Errorf("event error = %v, want it masked", ev.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no CommandFailed event")
+	}
+	en := sp.Table.Entries[0]
+	if en.ID != "tok-3141" {
+		t.Errorf("entry ID = %q, want it kept for selection", en.ID)
+	}
+	if en.Values[0] != secret.Mask || en.Matches != nil {
+		t.Errorf("entry values %q matches %v, want masked and no matches", en.Values, en.Matches)
+	}
+}
+
+func TestNoStateReturnsErrors(t *testing.T) {
+	reg := service.NewRegistry()
+	reg.AddCommands(&domain.Command{Aliases: []string{"go"}, FromStates: []int{domain.StateAny}, ToStates: []int{1}})
+	var e *Engine
+	ss := service.NewStateService(service.NewDefaultStateStore(reg.StateRegistry()), reg.StateRegistry())
+	cs := service.NewCommandService(reg.CommandRegistry(), func() *domain.Ctx { return NewCtxBuilder(e, reg)() })
+	e = New(reg.StateRegistry(), reg.ModeRegistry(), reg.CommandRegistry(), service.NewSpecService(), ss,
+		service.NewModeService(reg.ModeRegistry()), cs, Options{})
+	defer e.Close()
+
+	if _, _, err := e.Activate("a"); err == nil {
+		t.Error("Activate without a state should fail")
+	}
+	if _, _, err := e.Back(); err == nil {
+		t.Error("Back without a state should fail")
+	}
+	if _, _, err := e.Execute("go", nil); err == nil {
+		t.Error("Execute without a state should fail")
+	}
+}
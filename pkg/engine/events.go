@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/ourorg/goui/pkg/event"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/service"
+)
+
+// Events is the bus the engine publishes its lifecycle on, see package event.
+func (e *Engine) Events() *event.Bus {
+	return e.events
+}
+
+// Subscribe calls fn with engine events of the given kinds, all when none
+// are given, on its own goroutine and in order. The returned func
+// unsubscribes.
+func (e *Engine) Subscribe(fn func(event.Event), kinds ...event.Kind) func() {
+	return e.events.Subscribe(fn, kinds...)
+}
+
+// publishState forwards a commit of the state service.
+func (e *Engine) publishState(c service.StateChange) {
+	ev := event.Event{Kind: event.StateChanged, FromState: -1, ToState: -1, Cause: c.Cause}
+	if c.From != nil {
+		ev.FromState = c.From.ID
+	}
+	if c.To != nil {
+		ev.ToState = c.To.ID
+	}
+	e.events.Publish(ev)
+}
+
+// publishDispatch reports how a command returned.
+func (e *Engine) publishDispatch(line, msg string, err error, took time.Duration) {
+	ev := event.Event{Kind: event.CommandDispatched, Command: secret.Redact(line), Message: secret.Redact(msg), Duration: took}
+	if err != nil {
+		ev.Kind, ev.Err = event.CommandFailed, redactErr(err)
+	}
+	e.events.Publish(ev)
+}
+
+// execEvents is middleware publishing ExecStarted and ExecFinished, it sits
+// outside redaction so results are masked.
+func (e *Engine) execEvents() execx.Middleware {
+	return func(next execx.Handler) execx.Handler {
+		return func(c execx.Call) (execx.Result, error) {
+			call := &execx.Call{Mode: c.Mode, Template: c.Template}
+			for _, a := range c.Argv {
+				call.Argv = append(call.Argv, secret.Redact(a))
+			}
+			if c.Opts.Label != "" {
+				call.Template, call.Argv = "", []string{c.Opts.Label}
+			}
+			e.events.Publish(event.Event{Kind: event.ExecStarted, Exec: call})
+			start := time.Now()
+			res, err := next(c)
+			out := res
+			if c.Opts.Label != "" {
+				out.Command, out.Argv = c.Opts.Label, nil
+			}
+			e.events.Publish(event.Event{Kind: event.ExecFinished, Exec: call, Result: &out, Err: redactErr(err), Duration: time.Since(start)})
+			return res, err
+		}
+	}
+}
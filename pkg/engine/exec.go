@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/execx"
+)
+
+// ErrCommandRunning is returned when the executor is switched mid-command.
+var ErrCommandRunning = errors.New("a command is running, switch the executor when it is done")
+
+// SetExec swaps the executor for one built from cfg. It fails while a
+// command is running; commands switch through Ctx.SetExecMode instead, which
+// takes effect once they return.
+func (e *Engine) SetExec(cfg execx.Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dispatching > 0 {
+		return ErrCommandRunning
+	}
+	if err := checkExecConfig(cfg); err != nil {
+		return err
+	}
+	e.applyExec(cfg, e.profileOf(cfg))
+	return nil
+}
+
+// UseProfile switches to a named target from Options.Profiles.
+func (e *Engine) UseProfile(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cfg, ok := e.profiles[name]
+	if !ok {
+		return fmt.Errorf("no exec profile %q", name)
+	}
+	if e.dispatching > 0 {
+		return ErrCommandRunning
+	}
+	if err := checkExecConfig(cfg); err != nil {
+		return err
+	}
+	e.applyExec(cfg, name)
+	return nil
+}
+
+// Profiles lists the names of the configured exec profiles, sorted.
+func (e *Engine) Profiles() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.profileNames()
+}
+
+func (e *Engine) profileNames() []string {
+	names := make([]string, 0, len(e.profiles))
+	for n := range e.profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExecConfig returns the config the current executor was built from.
+func (e *Engine) ExecConfig() execx.Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.execCfg
+}
+
+// Status is the status line summary of where commands run, e.g.
+// "ssh ops@web1 [prod] dry-run read-only".
+func (e *Engine) Status() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status()
+}
+
+func (e *Engine) status() string {
+	parts := []string{e.execCfg.Mode.String()}
+	if e.execCfg.Mode == execx.ModeSSH || e.execCfg.Mode == execx.ModeLocal {
+		parts = append(parts, e.execCfg.Target())
+	}
+	if e.profile != "" {
+		parts = append(parts, "["+e.profile+"]")
+	}
+	if e.dryRun {
+		parts = append(parts, "dry-run")
+	}
+	if e.readOnly {
+		parts = append(parts, "read-only")
+	}
+	return strings.Join(parts, " ")
+}
+
+// requestExec backs Ctx.SetExecMode: the switch waits for the running
+// command to return so it never changes executors under its feet.
+func (e *Engine) requestExec(mode execx.Mode, cfg execx.Config) error {
+	cfg.Mode = mode
+	if err := checkExecConfig(cfg); err != nil {
+		return err
+	}
+	if e.dispatching == 0 {
+		e.applyExec(cfg, e.profileOf(cfg))
+		return nil
+	}
+	e.nextExec = &cfg
+	return nil
+}
+
+// applyPendingExec runs after the outermost command returned.
+func (e *Engine) applyPendingExec() {
+	if e.nextExec == nil {
+		return
+	}
+	cfg := *e.nextExec
+	e.nextExec = nil
+	e.applyExec(cfg, e.profileOf(cfg))
+}
+
+func (e *Engine) applyExec(cfg execx.Config, profile string) {
+	if c, dry := splitDryRun(cfg); dry {
+		cfg = c
+		e.dryRun = true
+	}
+	e.execCfg = cfg
+	e.profile = profile
+	e.resetExecutor()
+}
+
+// splitDryRun turns a ModeDryRun config into the mode it previews, ssh when
+// a host is set and local otherwise, like execx.NewDryRun picks. Dry run is
+// kept as the engine's toggle so SetDryRun(false) runs that target for real.
+func splitDryRun(cfg execx.Config) (execx.Config, bool) {
+	if cfg.Mode != execx.ModeDryRun {
+		return cfg, false
+	}
+	cfg.Mode = execx.ModeLocal
+	if cfg.SSHHost != "" {
+		cfg.Mode = execx.ModeSSH
+	}
+	return cfg, true
+}
+
+// profileOf names the profile cfg was taken from, empty for ad hoc targets.
+// Of several matching profiles the first by name wins, so the status line
+// does not change between runs.
+func (e *Engine) profileOf(cfg execx.Config) string {
+	for _, name := range e.profileNames() {
+		p := e.profiles[name]
+		if p.Mode == cfg.Mode && p.SSHHost == cfg.SSHHost && p.SSHUser == cfg.SSHUser {
+			return name
+		}
+	}
+	return ""
+}
+
+func checkExecConfig(cfg execx.Config) error {
+	cfg, _ = splitDryRun(cfg)
+	switch cfg.Mode {
+	case execx.ModeSSH:
+		if cfg.SSHHost == "" {
+			return errors.New("ssh needs a host")
+		}
+		// ssh would take these as options, e.g. -oProxyCommand=...
+		if strings.HasPrefix(cfg.SSHHost, "-") || strings.HasPrefix(cfg.SSHUser, "-") {
+			return fmt.Errorf("invalid ssh target %q", cfg.Target())
+		}
+	case execx.ModeDemo, execx.ModeLocal:
+	default:
+		return fmt.Errorf("unknown exec mode %d", cfg.Mode)
+	}
+	return nil
+}
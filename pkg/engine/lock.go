@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/service"
+)
+
+// The engine is safe for concurrent use: e.mu serializes command dispatch
+// and everything else that reads or changes engine or state data, so
+// callers on other goroutines, like an API server or background jobs, wait
+// for the running command.
+//
+// Handlers run with e.mu held. The Ctx they get calls back into the engine
+// (Dispatch, State, Spec, SetExecMode) inline while the command that built
+// it is running on the dispatching goroutine, and locks like any other
+// caller once the handler went to the background, see Ctx.Blocking for
+// long waits. Handlers and app callbacks the engine calls, like OnSelect,
+// must use the Ctx, not the Engine they were registered with, and handlers
+// of Parallel bulk commands must not change state, they run side by side.
+
+// enter locks the engine for a public call that may run handlers and opens
+// the scope their Ctx callbacks run inline in.
+func (e *Engine) enter() func() {
+	e.mu.Lock()
+	scope, cancel := context.WithCancel(context.Background())
+	e.scope = scope
+	return func() {
+		cancel()
+		e.scope = nil
+		e.mu.Unlock()
+	}
+}
+
+// inlineFor reports whether a Ctx built now, whose Context is read through
+// ctxOf, is still used by its command on the dispatching goroutine: its
+// Context is the scope of the running call, which a background job
+// replaces, and that call has not returned.
+func (e *Engine) inlineFor(ctxOf func() context.Context) func() bool {
+	scope := e.scope
+	return func() bool {
+		return scope != nil && ctxOf() == scope && scope.Err() == nil
+	}
+}
+
+// guard runs f inline or under the engine lock.
+func (e *Engine) guard(inline func() bool, f func() error) error {
+	if inline == nil || !inline() {
+		defer e.enter()()
+	}
+	return f()
+}
+
+// notify sends msg to the info sink, from any goroutine.
+func (e *Engine) notify(msg string) {
+	e.infoMu.Lock()
+	info := e.info
+	e.infoMu.Unlock()
+	if info != nil {
+		info(msg)
+	}
+}
+
+// StateCtrl exposes a writer view for UIs and commands, each write waits
+// for the running command.
+func (e *Engine) StateCtrl() domain.StateWriter {
+	return stateWriter{e: e}
+}
+
+type stateWriter struct {
+	e      *Engine
+	inline func() bool
+}
+
+func (w stateWriter) SetNextState(id int, mutateArgs func(map[string]interface{})) error {
+	return w.e.guard(w.inline, func() error { return w.e.stateService.SetNextState(id, mutateArgs) })
+}
+
+func (w stateWriter) UpdateArgs(mutateArgs func(map[string]interface{})) error {
+	return w.e.guard(w.inline, func() error { return w.e.stateService.UpdateArgs(mutateArgs) })
+}
+
+func (w stateWriter) Push(id int, mutateArgs func(map[string]interface{})) error {
+	return w.e.guard(w.inline, func() error { return w.e.stateService.Push(id, mutateArgs) })
+}
+
+func (w stateWriter) Pop() error {
+	return w.e.guard(w.inline, func() error { return w.e.stateService.Pop() })
+}
+
+var _ service.StateWriter = stateWriter{}
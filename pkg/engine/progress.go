@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ourorg/goui/pkg/domain"
+)
+
+// DefaultProgressInterval is the least time between two updates of one
+// command or sub-task that subscribers see, see Options.ProgressInterval.
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// OnProgress subscribes fn to progress updates of running commands and
+// returns a func that unsubscribes it. Updates are throttled: within an
+// interval only the latest one is delivered, at its end, while Done
+// updates always go out at once. fn is called from the reporting command's
+// goroutine or a timer, one update at a time, and must not report
+// progress itself.
+func (e *Engine) OnProgress(fn func(domain.Progress)) func() {
+	return e.progress.subscribe(fn)
+}
+
+type progressHub struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	seq   int
+	subs  map[int]func(domain.Progress)
+	tasks map[progressKey]map[string]*throttle
+
+	// held while delivering so subscribers see updates in order
+	deliverMu sync.Mutex
+}
+
+type progressKey struct {
+	command string
+	job     int
+}
+
+type throttle struct {
+	last    time.Time
+	pending *domain.Progress
+	timer   *time.Timer
+}
+
+func newProgressHub(interval time.Duration) *progressHub {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &progressHub{
+		interval: interval,
+		subs:     map[int]func(domain.Progress){},
+		tasks:    map[progressKey]map[string]*throttle{},
+	}
+}
+
+func (h *progressHub) subscribe(fn func(domain.Progress)) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	id := h.seq
+	h.subs[id] = fn
+	return func() {
+		h.mu.Lock()
+		delete(h.subs, id)
+		h.mu.Unlock()
+	}
+}
+
+// publish is the sink of every ProgressReporter the engine hands out.
+func (h *progressHub) publish(p domain.Progress) {
+	k := progressKey{p.Command, p.Job}
+	h.mu.Lock()
+	tasks := h.tasks[k]
+	if p.Done {
+		if tasks == nil {
+			// the command never reported progress, nothing to finish
+			h.mu.Unlock()
+			return
+		}
+		if p.Task == "" {
+			for _, t := range tasks {
+				t.stop()
+			}
+			delete(h.tasks, k)
+		} else if t := tasks[p.Task]; t != nil {
+			t.stop()
+			delete(tasks, p.Task)
+		}
+		h.deliver(p)
+		return
+	}
+	if tasks == nil {
+		tasks = map[string]*throttle{}
+		h.tasks[k] = tasks
+	}
+	t := tasks[p.Task]
+	if t == nil {
+		t = &throttle{}
+		tasks[p.Task] = t
+	}
+	now := time.Now()
+	if wait := t.last.Add(h.interval).Sub(now); wait > 0 {
+		t.pending = &p
+		if t.timer == nil {
+			t.timer = time.AfterFunc(wait, func() { h.flush(k, p.Task) })
+		}
+		h.mu.Unlock()
+		return
+	}
+	t.last, t.pending = now, nil
+	h.deliver(p)
+}
+
+// flush delivers the update held back by the throttle of a task.
+func (h *progressHub) flush(k progressKey, task string) {
+	h.mu.Lock()
+	t := h.tasks[k][task]
+	if t == nil || t.pending == nil {
+		h.mu.Unlock()
+		return
+	}
+	p := *t.pending
+	t.last, t.pending, t.timer = time.Now(), nil, nil
+	h.deliver(p)
+}
+
+// deliver hands p to the subscribers, called with h.mu held which it
+// releases.
+func (h *progressHub) deliver(p domain.Progress) {
+	subs := make([]func(domain.Progress), 0, len(h.subs))
+	for _, fn := range h.subs {
+		subs = append(subs, fn)
+	}
+	h.deliverMu.Lock()
+	h.mu.Unlock()
+	defer h.deliverMu.Unlock()
+	for _, fn := range subs {
+		fn(p)
+	}
+}
+
+func (t *throttle) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.pending = nil
+}
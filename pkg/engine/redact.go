@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// redactSpec masks resolved secrets in everything a renderer shows. Specs
+// are rebuilt per call, only the shared slices are copied before masking.
+// Entry IDs and the selection are left alone, commands address entries by
+// them. Highlight positions of masked values no longer line up and are
+// dropped.
+func redactSpec(sp spec.Spec) spec.Spec {
+	r := secret.Redact
+	sp.Info = r(sp.Info)
+	sp.Status = r(sp.Status)
+	sp.Breadcrumbs = redactAll(sp.Breadcrumbs)
+	if t := sp.Text; t != nil {
+		sp.Text = &spec.Text{Title: r(t.Title), Body: r(t.Body)}
+	}
+	if t := sp.Table; t != nil {
+		cp := *t
+		cp.Title = r(t.Title)
+		cp.Headers = redactAll(t.Headers)
+		cp.Entries = make([]spec.Entry, len(t.Entries))
+		for i, en := range t.Entries {
+			vals := redactAll(en.Values)
+			if !equalStrings(vals, en.Values) {
+				en.Matches = nil
+			}
+			en.Values = vals
+			cp.Entries[i] = en
+		}
+		if t.Groups != nil {
+			cp.Groups = make([]spec.Group, len(t.Groups))
+			for i, g := range t.Groups {
+				g.Key = r(g.Key)
+				cp.Groups[i] = g
+			}
+		}
+		cp.Rows = make([][]string, len(t.Rows))
+		for i, row := range t.Rows {
+			cp.Rows[i] = redactAll(row)
+		}
+		sp.Table = &cp
+	}
+	if l := sp.List; l != nil {
+		cp := *l
+		cp.Title = r(l.Title)
+		cp.Items = make([]spec.ListItem, len(l.Items))
+		for i, it := range l.Items {
+			main := r(it.Main)
+			if main != it.Main {
+				it.Matches = nil
+			}
+			it.Main, it.Secondary = main, r(it.Secondary)
+			cp.Items[i] = it
+		}
+		sp.List = &cp
+	}
+	return sp
+}
+
+// redactErr masks secrets in err's message. Errors without any keep their
+// identity so callers can still match them.
+func redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := secret.Redact(err.Error()); msg != err.Error() {
+		return errors.New(msg)
+	}
+	return err
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func redactAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = secret.Redact(v)
+	}
+	return out
+}
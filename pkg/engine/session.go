@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/service"
+)
+
+// SaveSession snapshots the current state, navigation history, command
+// history and exec mode. It is a no-op when no SessionPath was configured.
+func (e *Engine) SaveSession() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.saveSession()
+}
+
+func (e *Engine) saveSession() error {
+	if e.session == nil {
+		return nil
+	}
+	sess := &service.Session{
+		History:     service.SessionHistory(e.stateService.History()),
+		Commands:    e.commandService.History().Snapshot(),
+		ExecMode:    e.execMode,
+		ExecProfile: e.profile,
+		Sorts:       e.stateService.Sorts(),
+	}
+	if st := e.stateService.Current(); st != nil {
+		sess.StateID = st.ID
+		sess.StateArgs = service.SessionArgs(st.Args)
+	}
+	return e.session.Save(sess)
+}
+
+// Close cancels running jobs, stops periodic snapshots, saves the session
+// one last time and closes the event bus.
+// Apps call it from their quit handler.
+func (e *Engine) Close() error {
+	e.commandService.Jobs().CancelAll()
+	defer e.events.Close()
+	e.mu.Lock()
+	stop, done := e.stopSession, e.autosaved
+	e.stopSession = nil
+	e.mu.Unlock()
+	if stop != nil {
+		// a snapshot already waiting for the lock must not land after
+		// the final save
+		close(stop)
+		<-done
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.saveSession()
+}
+
+// restoreSession puts back the saved session, the exec target only when
+// the app did not set one explicitly.
+func (e *Engine) restoreSession(explicitExec bool) {
+	sess, err := e.session.Load()
+	if err != nil {
+		logrus.Warnf("Failed to load session %s: %v", e.session.Path(), err)
+		return
+	}
+	if sess == nil {
+		return
+	}
+	e.commandService.History().Restore(sess.Commands)
+	e.stateService.RestoreSorts(sess.Sorts)
+	if err := e.stateService.Restore(sess.StateID, sess.StateArgs, sess.History); err != nil {
+		// The app may have dropped the state since the last run; keep the initial one
+		logrus.Warnf("Not restoring saved state: %v", err)
+	}
+	cfg, ok := e.profiles[sess.ExecProfile]
+	switch {
+	case explicitExec:
+		// Options.ExecMode and ExecConfig win over the saved target
+	case ok && sess.ExecProfile != "":
+		e.applyExec(cfg, sess.ExecProfile)
+	case sess.ExecMode != e.execMode:
+		cfg := e.execCfg
+		cfg.Mode = sess.ExecMode
+		e.execCfg = cfg
+		e.resetExecutor()
+	}
+	logrus.Debugf("Restored session saved at %s", sess.SavedAt.Format(time.RFC3339))
+}
+
+func (e *Engine) autosave(every time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := e.SaveSession(); err != nil {
+				logrus.Warnf("Failed to save session: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package event
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxQueued bounds the events waiting for one subscriber. A subscriber that
+// falls further behind loses the oldest ones, so a stuck callback cannot
+// grow memory without end.
+const MaxQueued = 4096
+
+// Bus fans events out to subscribers, safe for concurrent use.
+type Bus struct {
+	mu     sync.Mutex
+	seq    int
+	subs   map[int]*subscriber
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]*subscriber{}}
+}
+
+type subscriber struct {
+	fn    func(Event)
+	kinds map[Kind]bool // nil for all
+
+	mu      sync.Mutex
+	queue   []Event
+	dropped int // since the queue last ran dry
+	wake    chan struct{}
+	quit    chan struct{}
+}
+
+// Subscribe calls fn with every event of the given kinds, or all kinds when
+// none are given, and returns a func that unsubscribes it. Events still
+// queued for fn are dropped on unsubscribe, see also MaxQueued.
+func (b *Bus) Subscribe(fn func(Event), kinds ...Kind) func() {
+	s := &subscriber{
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+	}
+	if len(kinds) > 0 {
+		s.kinds = map[Kind]bool{}
+		for _, k := range kinds {
+			s.kinds[k] = true
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	b.seq++
+	id := b.seq
+	b.subs[id] = s
+	go s.run()
+
+	return func() {
+		// whoever removes s from subs stops it, so an unsubscribe racing
+		// Close or itself closes quit once
+		b.mu.Lock()
+		_, ok := b.subs[id]
+		delete(b.subs, id)
+		b.mu.Unlock()
+		if ok {
+			close(s.quit)
+		}
+	}
+}
+
+// Publish queues e for every interested subscriber and returns at once.
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	// queued under b.mu so all subscribers see one order
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs {
+		if s.kinds == nil || s.kinds[e.Kind] {
+			s.push(e)
+		}
+	}
+}
+
+// Close unsubscribes everyone, later publishes go nowhere.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, s := range b.subs {
+		close(s.quit)
+		delete(b.subs, id)
+	}
+	b.closed = true
+}
+
+func (s *subscriber) push(e Event) {
+	s.mu.Lock()
+	if len(s.queue) >= MaxQueued {
+		s.queue[0] = Event{}
+		s.queue = s.queue[1:]
+		if s.dropped++; s.dropped == 1 {
+			logrus.Warnf("Event subscriber is %d events behind, dropping the oldest", MaxQueued)
+		}
+	}
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default: // already woken
+	}
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.dropped = 0
+				s.mu.Unlock()
+				break
+			}
+			e := s.queue[0]
+			s.queue[0] = Event{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.call(e)
+		}
+	}
+}
+
+// call keeps a panicking subscriber from taking the app down.
+func (s *subscriber) call(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf("Event subscriber panicked on %s: %v", e.Kind, r)
+		}
+	}()
+	s.fn(e)
+}
@@ -0,0 +1,53 @@
+package event
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUnsubscribeAndClose(t *testing.T) {
+	orders := map[string]func(b *Bus, unsub func()){
+		"unsubscribe then close": func(b *Bus, unsub func()) { unsub(); b.Close(); unsub() },
+		"close then unsubscribe": func(b *Bus, unsub func()) { b.Close(); unsub(); unsub() },
+		"concurrently": func(b *Bus, unsub func()) {
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() { defer wg.Done(); unsub() }()
+				go func() { defer wg.Done(); b.Close() }()
+			}
+			wg.Wait()
+		},
+	}
+	for name, run := range orders {
+		t.Run(name, func(t *testing.T) {
+			b := NewBus()
+			unsub := b.Subscribe(func(Event) {})
+			run(b, unsub) // panics on a double close
+		})
+	}
+}
+
+func TestQueueIsBounded(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+	block := make(chan struct{})
+	got := make(chan Event, MaxQueued+1)
+	b.Subscribe(func(e Event) {
+		<-block
+		got <- e
+	})
+	for i := 0; i < 3*MaxQueued; i++ {
+		b.Publish(Event{Message: "x"})
+	}
+	b.mu.Lock()
+	for _, s := range b.subs {
+		s.mu.Lock()
+		if n := len(s.queue); n > MaxQueued {
+			t.Errorf("%d events queued, want at most %d", n, MaxQueued)
+		}
+		s.mu.Unlock()
+	}
+	b.mu.Unlock()
+	close(block)
+}
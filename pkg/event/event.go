@@ -0,0 +1,81 @@
+// Package event is a typed bus for engine lifecycle and state changes.
+//
+// Publishing never blocks: every subscriber has its own queue drained by
+// its own goroutine, so a slow subscriber only delays itself and sees
+// events in the order they were published.
+package event
+
+import (
+	"time"
+
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// Kind tells what happened, and which fields of Event are set.
+type Kind int
+
+const (
+	// A command ran and returned: Command, Message, Duration
+	CommandDispatched Kind = iota + 1
+	// A command returned an error: Command, Message, Err, Duration
+	CommandFailed
+	// The current state was replaced: FromState, ToState, Cause
+	StateChanged
+	// The mode changed: FromMode, ToMode
+	ModeChanged
+	// The spec of the current state was built: Spec
+	SpecRebuilt
+	// A process is about to run: Exec
+	ExecStarted
+	// A process finished: Exec, Result, Err, Duration
+	ExecFinished
+)
+
+func (k Kind) String() string {
+	switch k {
+	case CommandDispatched:
+		return "CommandDispatched"
+	case CommandFailed:
+		return "CommandFailed"
+	case StateChanged:
+		return "StateChanged"
+	case ModeChanged:
+		return "ModeChanged"
+	case SpecRebuilt:
+		return "SpecRebuilt"
+	case ExecStarted:
+		return "ExecStarted"
+	case ExecFinished:
+		return "ExecFinished"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event is one thing that happened, see Kind for the fields each sets.
+type Event struct {
+	Kind Kind
+	At   time.Time
+
+	Command  string
+	Message  string
+	Err      error
+	Duration time.Duration
+
+	// State IDs, FromState is -1 when there was none
+	FromState int
+	ToState   int
+	// What moved the state, e.g. SetNextState, Push, Pop, Undo
+	Cause string
+
+	FromMode int
+	ToMode   int
+
+	Spec *spec.Spec
+
+	// The run as the executor got it, secrets masked and without its data
+	// and options
+	Exec   *execx.Call
+	Result *execx.Result
+}
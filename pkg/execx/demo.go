@@ -1,8 +1,6 @@
 package execx
 
 import (
-	"bytes"
-	"text/template"
 	"time"
 )
 
@@ -16,7 +14,14 @@ func NewDemo(cfg Config) Executor {
 func (e *demoExec) Mode() Mode { return ModeDemo }
 
 func (e *demoExec) Run(argv ...string) (Result, error) {
-	if e.cfg.DemoLatency > 0 { time.Sleep(e.cfg.DemoLatency) }
+	return e.RunWith(Options{}, argv...)
+}
+
+// RunWith ignores the options but the context, nothing runs in demo mode.
+func (e *demoExec) RunWith(opts Options, argv ...string) (Result, error) {
+	if e.cfg.DemoLatency > 0 {
+		if err := sleep(opts.Context, e.cfg.DemoLatency); err != nil { return Result{}, err }
+	}
 	return Result{
 		Stdout:   "demo: " + join(argv),
 		Stderr:   "",
@@ -24,12 +29,16 @@ func (e *demoExec) Run(argv ...string) (Result, error) {
 	}, nil
 }
 
-func (e *demoExec) RunTemplate(tmpl string, data map[string]interface{}) (Result, error) {
-	t, err := template.New("cmd").Parse(tmpl)
+func (e *demoExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
+}
+
+func (e *demoExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	r, err := RenderCommand(text, data, e.cfg.ShellMode)
 	if err != nil { return Result{}, err }
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, data); err != nil { return Result{}, err }
-	return e.Run(buf.String())
+	res, err := e.RunWith(opts, r.Line)
+	res.Command = r.Line
+	return res, err
 }
 
 func join(a []string) string {
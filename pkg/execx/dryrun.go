@@ -0,0 +1,114 @@
+package execx
+
+import (
+	"strings"
+	"sync"
+)
+
+// dryRunExec renders and wraps commands exactly like the local or ssh
+// executor would, then records them instead of starting a process.
+type dryRunExec struct {
+	cfg Config
+	ssh bool
+
+	mu  sync.Mutex
+	log []Result
+}
+
+// NewDryRun previews cfg.Mode when it is local or ssh. Other modes preview
+// ssh when a host is configured and local otherwise.
+func NewDryRun(cfg Config) Executor {
+	ssh := cfg.Mode == ModeSSH
+	if cfg.Mode != ModeLocal && cfg.Mode != ModeSSH {
+		ssh = cfg.SSHHost != ""
+	}
+	return &dryRunExec{cfg: cfg, ssh: ssh}
+}
+
+func (e *dryRunExec) Mode() Mode { return ModeDryRun }
+
+func (e *dryRunExec) Run(argv ...string) (Result, error) {
+	return e.RunWith(Options{}, argv...)
+}
+
+func (e *dryRunExec) RunWith(opts Options, argv ...string) (Result, error) {
+	return e.record(opts, strings.Join(argv, " "), argv), nil
+}
+
+func (e *dryRunExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
+}
+
+func (e *dryRunExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	r, err := RenderCommand(text, data, e.cfg.ShellMode)
+	if err != nil {
+		return Result{}, err
+	}
+	shellFlag := "-c"
+	if e.ssh {
+		shellFlag = "-lc"
+	}
+	return e.record(opts, r.Line, r.argv(shellFlag)), nil
+}
+
+// record keeps the argv that would start. Locally the env and dir are not
+// part of it, so the preview spells them out like ssh would.
+func (e *dryRunExec) record(opts Options, line string, argv []string) Result {
+	shown := opts.shellLine(argv)
+	if e.ssh {
+		argv = sshArgv(e.cfg, opts, argv)
+		shown = QuoteArgv(argv)
+	}
+	res := Result{
+		Stdout:  "dry-run: " + shown,
+		Command: line,
+		Argv:    argv,
+	}
+	e.mu.Lock()
+	e.log = append(e.log, res)
+	e.mu.Unlock()
+	return res
+}
+
+// Recorded returns what ran since the last call and clears the record.
+func (e *dryRunExec) Recorded() []Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := e.log
+	e.log = nil
+	return out
+}
+
+// Recorder is implemented by executors that keep what they were asked to
+// run, like the dry-run executor.
+type Recorder interface {
+	Recorded() []Result
+}
+
+// QuoteArgv joins argv into a line a POSIX shell splits back into argv.
+func QuoteArgv(argv []string) string {
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		out[i] = ShellQuote(a)
+	}
+	return strings.Join(out, " ")
+}
+
+// ShellQuote single-quotes s unless it only holds characters that are
+// safe unquoted.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@,+%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -10,6 +10,8 @@ const (
 	ModeDemo Mode = iota
 	ModeLocal
 	ModeSSH
+	// ModeDryRun records what local or ssh mode would run without running it
+	ModeDryRun
 )
 
 func (m Mode) String() string {
@@ -20,6 +22,8 @@ func (m Mode) String() string {
 		return "local"
 	case ModeSSH:
 		return "ssh"
+	case ModeDryRun:
+		return "dry-run"
 	default:
 		return "unknown"
 	}
@@ -34,12 +38,27 @@ type Config struct {
 	SSHOptions []string // extra ssh -o options
 	// demo behavior
 	DemoLatency time.Duration
+	// Run templates through sh -c instead of as argv, see RenderCommand
+	ShellMode bool
 }
 
 type Result struct {
 	Stdout   string
 	Stderr   string
 	ExitCode int
+
+	// Rendered command line, set by RunTemplate
+	Command string
+	// Process argv that was (or in dry-run mode would be) started
+	Argv []string
+	// Output went over Options.MaxOutput and was cut
+	Truncated bool
+	// Wall time of the run, set by the Timing middleware
+	Duration time.Duration
+	// Runs it took, set by the Retry middleware
+	Attempts int
+	// Killed for running past its timeout
+	TimedOut bool
 }
 
 // Executor is the unified command runner
@@ -47,4 +66,24 @@ type Executor interface {
 	Mode() Mode
 	Run(argv ...string) (Result, error)
 	RunTemplate(tmpl string, data map[string]interface{}) (Result, error)
-}
\ No newline at end of file
+	// RunWith and RunTemplateWith apply per run options, see Options
+	RunWith(opts Options, argv ...string) (Result, error)
+	RunTemplateWith(opts Options, tmpl string, data map[string]interface{}) (Result, error)
+}
+
+// Target names where commands run, for prompts and status lines.
+func (c Config) Target() string {
+	switch c.Mode {
+	case ModeSSH:
+		if c.SSHUser != "" {
+			return c.SSHUser + "@" + c.SSHHost
+		}
+		return c.SSHHost
+	case ModeLocal:
+		return "localhost"
+	case ModeDryRun:
+		return "dry run"
+	default:
+		return "demo"
+	}
+}
@@ -1,11 +1,6 @@
 package execx
 
 import (
-	"bytes"
-	"context"
-	"os/exec"
-	"strings"
-	"text/template"
 	"time"
 )
 
@@ -19,36 +14,24 @@ func NewLocal(cfg Config) Executor {
 func (e *localExec) Mode() Mode { return ModeLocal }
 
 func (e *localExec) Run(argv ...string) (Result, error) {
+	return e.RunWith(Options{}, argv...)
+}
+
+func (e *localExec) RunWith(opts Options, argv ...string) (Result, error) {
 	if len(argv) == 0 { return Result{}, nil }
-	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
-	var out, errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-
-	runErr := cmd.Run()
-	exit := 0
-	if cmd.ProcessState != nil {
-		exit = cmd.ProcessState.ExitCode()
-	}
-	return Result{
-		Stdout:   strings.TrimRight(out.String(), "\n"),
-		Stderr:   strings.TrimRight(errb.String(), "\n"),
-		ExitCode: exit,
-	}, runErr
+	return runProcess(e.cfg, opts, argv, true)
 }
 
-func (e *localExec) RunTemplate(tmpl string, data map[string]interface{}) (Result, error) {
-	t, err := template.New("cmd").Parse(tmpl)
+func (e *localExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
+}
+
+func (e *localExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	r, err := RenderCommand(text, data, e.cfg.ShellMode)
 	if err != nil {
-		// fallback: treat as shell command
-		return e.Run("sh", "-c", tmpl)
-	}
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, data); err != nil {
 		return Result{}, err
 	}
-	return e.Run("sh", "-c", buf.String())
-}
\ No newline at end of file
+	res, err := e.RunWith(opts, r.argv("-c")...)
+	res.Command = r.Line
+	return res, err
+}
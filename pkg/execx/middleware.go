@@ -0,0 +1,138 @@
+package execx
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Call is one run passing through the middleware chain. Template is set
+// for RunTemplate calls, Argv for Run calls.
+type Call struct {
+	Mode     Mode
+	Opts     Options
+	Argv     []string
+	Template string
+	Data     map[string]interface{}
+}
+
+// Handler runs a call, the innermost one hands it to the executor.
+type Handler func(Call) (Result, error)
+
+// Middleware wraps every run of an executor, e.g. to log, time or retry it.
+type Middleware func(next Handler) Handler
+
+// Chain returns e with every Run and RunTemplate passing through mws, the
+// first one outermost.
+func Chain(e Executor, mws ...Middleware) Executor {
+	if len(mws) == 0 {
+		return e
+	}
+	h := Handler(func(c Call) (Result, error) {
+		if c.Template != "" {
+			return e.RunTemplateWith(c.Opts, c.Template, c.Data)
+		}
+		return e.RunWith(c.Opts, c.Argv...)
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return &chainExec{inner: e, handler: h}
+}
+
+type chainExec struct {
+	inner   Executor
+	handler Handler
+}
+
+func (e *chainExec) Mode() Mode { return e.inner.Mode() }
+
+func (e *chainExec) Run(argv ...string) (Result, error) {
+	return e.RunWith(Options{}, argv...)
+}
+
+func (e *chainExec) RunWith(opts Options, argv ...string) (Result, error) {
+	return e.handler(Call{Mode: e.inner.Mode(), Opts: opts, Argv: argv})
+}
+
+func (e *chainExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
+}
+
+func (e *chainExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	return e.handler(Call{Mode: e.inner.Mode(), Opts: opts, Template: text, Data: data})
+}
+
+// Logging logs every run with its command, exit code and duration, failures
+// as warnings. A nil logger uses the logrus standard logger.
+func Logging(log logrus.FieldLogger) Middleware {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	return func(next Handler) Handler {
+		return func(c Call) (Result, error) {
+			start := time.Now()
+			res, err := next(c)
+			fields := logrus.Fields{
+				"mode":     c.Mode.String(),
+				"argv":     QuoteArgv(res.Argv),
+				"exit":     res.ExitCode,
+				"duration": time.Since(start).Round(time.Millisecond).String(),
+			}
+			if res.Command != "" {
+				fields["command"] = res.Command
+			}
+			if c.Opts.Label != "" {
+				fields["argv"] = c.Opts.Label
+				delete(fields, "command")
+			}
+			entry := log.WithFields(fields)
+			switch {
+			case err != nil:
+				entry.WithError(err).Warn("Command failed")
+			case res.ExitCode != 0:
+				entry.Warn("Command exited non-zero")
+			default:
+				entry.Info("Command ran")
+			}
+			return res, err
+		}
+	}
+}
+
+// Timing sets Result.Duration and reports it to observe, if not nil, for
+// latency metrics.
+func Timing(observe func(Call, Result, error)) Middleware {
+	return func(next Handler) Handler {
+		return func(c Call) (Result, error) {
+			start := time.Now()
+			res, err := next(c)
+			res.Duration = time.Since(start)
+			if observe != nil {
+				observe(c, res, err)
+			}
+			return res, err
+		}
+	}
+}
+
+// Redact masks secrets in what a run returns: output, the rendered
+// command and the argv, e.g. with secret.Redact.
+func Redact(mask func(string) string) Middleware {
+	return func(next Handler) Handler {
+		return func(c Call) (Result, error) {
+			res, err := next(c)
+			res.Stdout = mask(res.Stdout)
+			res.Stderr = mask(res.Stderr)
+			res.Command = mask(res.Command)
+			if len(res.Argv) > 0 {
+				argv := make([]string, len(res.Argv))
+				for i, a := range res.Argv {
+					argv[i] = mask(a)
+				}
+				res.Argv = argv
+			}
+			return res, err
+		}
+	}
+}
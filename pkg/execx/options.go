@@ -0,0 +1,226 @@
+package execx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options tune a single run. Commands and states declare them, see
+// WithOptions, and every executor honors them the same way: over ssh the
+// env and dir apply on the remote host.
+type Options struct {
+	// Overlay on the inherited environment
+	Env map[string]string
+	// Working directory, empty keeps the executor's
+	Dir string
+	// Called once per run for the command's stdin, so repeated, retried and
+	// parallel runs each read the whole input, see StdinBytes
+	Stdin func() io.Reader
+	// Overrides Config.Timeout when set
+	Timeout time.Duration
+	// Bytes kept per output stream, 0 keeps everything, see Result.Truncated
+	MaxOutput int
+	// Canceling it kills the run, e.g. when its background job is canceled
+	Context context.Context
+	// Stands in for the command line in logs and the audit log, e.g. the
+	// alias of a command whose args are secrets
+	Label string
+}
+
+// StdinBytes feeds b to every run.
+func StdinBytes(b []byte) func() io.Reader {
+	return func() io.Reader { return bytes.NewReader(b) }
+}
+
+// IsZero reports whether o changes nothing.
+func (o Options) IsZero() bool {
+	return len(o.Env) == 0 && o.Dir == "" && o.Stdin == nil && o.Timeout == 0 && o.MaxOutput == 0 && o.Context == nil && o.Label == ""
+}
+
+// Merge returns o with the fields set in over taking precedence, env
+// variables are merged key by key.
+func (o Options) Merge(over Options) Options {
+	out := o
+	if len(over.Env) > 0 {
+		out.Env = make(map[string]string, len(o.Env)+len(over.Env))
+		for k, v := range o.Env {
+			out.Env[k] = v
+		}
+		for k, v := range over.Env {
+			out.Env[k] = v
+		}
+	}
+	if over.Dir != "" {
+		out.Dir = over.Dir
+	}
+	if over.Stdin != nil {
+		out.Stdin = over.Stdin
+	}
+	if over.Timeout != 0 {
+		out.Timeout = over.Timeout
+	}
+	if over.MaxOutput != 0 {
+		out.MaxOutput = over.MaxOutput
+	}
+	if over.Context != nil {
+		out.Context = over.Context
+	}
+	if over.Label != "" {
+		out.Label = over.Label
+	}
+	return out
+}
+
+// envList renders the overlay as sorted K=V pairs.
+func (o Options) envList() []string {
+	out := make([]string, 0, len(o.Env))
+	for k, v := range o.Env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// shellLine is argv as one shell command with the dir and env applied, the
+// form ssh runs remotely.
+func (o Options) shellLine(argv []string) string {
+	if len(o.Env) > 0 {
+		argv = append(append([]string{"env"}, o.envList()...), argv...)
+	}
+	line := QuoteArgv(argv)
+	if o.Dir != "" {
+		line = "cd " + ShellQuote(o.Dir) + " && " + line
+	}
+	return line
+}
+
+// WithOptions returns an executor that applies opts to every run, under
+// the options of each call. Wrapping twice layers the options, the outer
+// wrapper winning.
+func WithOptions(e Executor, opts Options) Executor {
+	if opts.IsZero() {
+		return e
+	}
+	return &optionsExec{inner: e, opts: opts}
+}
+
+type optionsExec struct {
+	inner Executor
+	opts  Options
+}
+
+func (e *optionsExec) Mode() Mode { return e.inner.Mode() }
+
+func (e *optionsExec) Run(argv ...string) (Result, error) {
+	return e.RunWith(Options{}, argv...)
+}
+
+func (e *optionsExec) RunWith(opts Options, argv ...string) (Result, error) {
+	return e.inner.RunWith(e.opts.Merge(opts), argv...)
+}
+
+func (e *optionsExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
+}
+
+func (e *optionsExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	return e.inner.RunTemplateWith(e.opts.Merge(opts), text, data)
+}
+
+// runProcess starts argv locally with the run options applied, the shared
+// core of the local and ssh executors.
+func runProcess(cfg Config, opts Options, argv []string, applyEnv bool) (Result, error) {
+	timeout := cfg.Timeout
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	if err := parent.Err(); err != nil {
+		return Result{Argv: argv}, err
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if applyEnv {
+		if len(opts.Env) > 0 {
+			cmd.Env = append(os.Environ(), opts.envList()...)
+		}
+		cmd.Dir = opts.Dir
+	}
+	if opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin()
+	}
+	out := &cappedBuffer{max: opts.MaxOutput}
+	errb := &cappedBuffer{max: opts.MaxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = errb
+
+	runErr := cmd.Run()
+	timedOut := ctx.Err() == context.DeadlineExceeded && parent.Err() == nil
+	if err := parent.Err(); err != nil {
+		runErr = err // killed on purpose, not a failure of the command
+	}
+	exit := 0
+	if cmd.ProcessState != nil {
+		exit = cmd.ProcessState.ExitCode()
+	}
+	return Result{
+		Stdout:    strings.TrimRight(out.String(), "\n"),
+		Stderr:    strings.TrimRight(errb.String(), "\n"),
+		ExitCode:  exit,
+		Argv:      argv,
+		Truncated: out.truncated || errb.truncated,
+		TimedOut:  timedOut,
+	}, runErr
+}
+
+// sleep waits for d, returning early with the error of ctx once it is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cappedBuffer keeps the first max bytes written and drops the rest without
+// failing the writer, so a chatty command still runs to completion. It does
+// not embed bytes.Buffer, whose ReadFrom would bypass the cap in io.Copy.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
@@ -0,0 +1,106 @@
+package execx
+
+import (
+	"math/rand"
+	"regexp"
+	"time"
+)
+
+// RetryPolicy declares when and how often a failed run is repeated.
+type RetryPolicy struct {
+	// Total attempts, 0 or 1 never retries
+	MaxAttempts int
+	// Delay before the first retry, doubled for each further one
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Fraction of the delay randomized, 0.2 waits 80% to 120% of it
+	Jitter float64
+
+	// What counts as flaky: exit codes, stderr regexps and timeouts
+	OnExitCodes []int
+	OnStderr    []string
+	OnTimeout   bool
+
+	// Called before each retry, e.g. to update the info line
+	OnRetry func(attempt int, delay time.Duration, res Result, err error)
+}
+
+// SSHRetry retries what usually is the connection, not the command: ssh
+// exits 255 when it cannot reach or authenticate to the host.
+var SSHRetry = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     500 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	Jitter:      0.2,
+	OnExitCodes: []int{255},
+	OnStderr:    []string{`(?i)connection (reset|refused|timed out)`},
+	OnTimeout:   true,
+}
+
+// Delay is the wait before the given retry, 1 being the first.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.Jitter > 0 && d > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Retry runs calls again while p says the failure is worth retrying. The
+// final Result carries the number of attempts. Every attempt reads a fresh
+// stdin from Options.Stdin.
+func Retry(p RetryPolicy) Middleware {
+	patterns := make([]*regexp.Regexp, 0, len(p.OnStderr))
+	for _, s := range p.OnStderr {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			re = regexp.MustCompile(regexp.QuoteMeta(s))
+		}
+		patterns = append(patterns, re)
+	}
+	retryable := func(res Result, err error) bool {
+		if res.TimedOut {
+			return p.OnTimeout
+		}
+		if err == nil && res.ExitCode == 0 {
+			return false
+		}
+		for _, c := range p.OnExitCodes {
+			if res.ExitCode == c {
+				return true
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(res.Stderr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next Handler) Handler {
+		return func(c Call) (Result, error) {
+			attempt := 1
+			for {
+				res, err := next(c)
+				res.Attempts = attempt
+				if attempt >= p.MaxAttempts || !retryable(res, err) {
+					return res, err
+				}
+				delay := p.Delay(attempt)
+				if p.OnRetry != nil {
+					p.OnRetry(attempt+1, delay, res, err)
+				}
+				if serr := sleep(c.Opts.Context, delay); serr != nil {
+					return res, serr
+				}
+				attempt++
+			}
+		}
+	}
+}
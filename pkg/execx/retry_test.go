@@ -0,0 +1,50 @@
+package execx
+
+import (
+	"io"
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+func TestRetryReplaysStdin(t *testing.T) {
+	flaky := RetryPolicy{MaxAttempts: 3, OnExitCodes: []int{255}}
+	var reads []string
+	h := Retry(flaky)(func(c Call) (Result, error) {
+		b, _ := io.ReadAll(c.Opts.Stdin())
+		reads = append(reads, string(b))
+		return Result{ExitCode: 255}, nil
+	})
+	res, _ := h(Call{Opts: Options{Stdin: StdinBytes([]byte("payload"))}})
+	if res.Attempts != 3 || len(reads) != 3 {
+		t.Fatalf("attempts = %d with %d reads, want 3", res.Attempts, len(reads))
+	}
+	for _, r := range reads {
+		if r != "payload" {
+			t.Errorf("attempt read %q, want payload", r)
+		}
+	}
+}
+
+func TestStdinIsFreshPerRun(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("no cat in PATH")
+	}
+	e := WithOptions(NewLocal(Config{Mode: ModeLocal}), Options{Stdin: StdinBytes([]byte("payload"))})
+	for i := 0; i < 2; i++ {
+		if res, err := e.Run("cat"); err != nil || res.Stdout != "payload" {
+			t.Errorf("run %d read %q, %v, want payload", i+1, res.Stdout, err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := e.Run("cat"); err != nil || res.Stdout != "payload" {
+				t.Errorf("parallel run read %q, %v, want payload", res.Stdout, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,11 +1,6 @@
 package execx
 
 import (
-	"bytes"
-	"context"
-	"os/exec"
-	"strings"
-	"text/template"
 	"time"
 )
 
@@ -21,49 +16,41 @@ func NewSSH(cfg Config) Executor {
 func (e *sshExec) Mode() Mode { return ModeSSH }
 
 func (e *sshExec) Run(argv ...string) (Result, error) {
+	return e.RunWith(Options{}, argv...)
+}
+
+// RunWith applies the env and dir on the remote host, stdin is forwarded.
+func (e *sshExec) RunWith(opts Options, argv ...string) (Result, error) {
 	if e.cfg.SSHHost == "" { return Result{Stderr: "ssh host not set"}, nil }
+	return runProcess(e.cfg, opts, sshArgv(e.cfg, opts, argv), false)
+}
 
+// sshArgv wraps argv into the local ssh invocation that runs it remotely.
+func sshArgv(cfg Config, opts Options, argv []string) []string {
 	sshArgs := make([]string, 0, 8)
-	sshArgs = append(sshArgs, "-o", "BatchMode=yes")
-	for _, o := range e.cfg.SSHOptions {
+	sshArgs = append(sshArgs, "ssh", "-o", "BatchMode=yes")
+	for _, o := range cfg.SSHOptions {
 		sshArgs = append(sshArgs, "-o", o)
 	}
-	target := e.cfg.SSHHost
-	if e.cfg.SSHUser != "" { target = e.cfg.SSHUser + "@" + target }
-	sshArgs = append(sshArgs, target)
-
-	// command string to run remotely
-	cmdStr := strings.Join(argv, " ")
-	sshArgs = append(sshArgs, cmdStr)
+	target := cfg.SSHHost
+	if cfg.SSHUser != "" { target = cfg.SSHUser + "@" + target }
+	// end of options, a host such as -oProxyCommand=... stays a host
+	sshArgs = append(sshArgs, "--", target)
 
-	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
-	defer cancel()
+	// ssh hands the remote shell one string, quote so it splits back into argv
+	return append(sshArgs, opts.shellLine(argv))
+}
 
-	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
-	var out, errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-	runErr := cmd.Run()
-	exit := 0
-	if cmd.ProcessState != nil {
-		exit = cmd.ProcessState.ExitCode()
-	}
-	return Result{
-		Stdout:   strings.TrimRight(out.String(), "\n"),
-		Stderr:   strings.TrimRight(errb.String(), "\n"),
-		ExitCode: exit,
-	}, runErr
+func (e *sshExec) RunTemplate(text string, data map[string]interface{}) (Result, error) {
+	return e.RunTemplateWith(Options{}, text, data)
 }
 
-func (e *sshExec) RunTemplate(tmpl string, data map[string]interface{}) (Result, error) {
-	t, err := template.New("cmd").Parse(tmpl)
+func (e *sshExec) RunTemplateWith(opts Options, text string, data map[string]interface{}) (Result, error) {
+	r, err := RenderCommand(text, data, e.cfg.ShellMode)
 	if err != nil {
-		// simplest path
-		return e.Run("sh", "-lc", tmpl)
-	}
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, data); err != nil {
 		return Result{}, err
 	}
-	return e.Run("sh", "-lc", buf.String())
-}
\ No newline at end of file
+	res, err := e.RunWith(opts, r.argv("-lc")...)
+	res.Command = r.Line
+	return res, err
+}
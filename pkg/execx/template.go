@@ -0,0 +1,248 @@
+package execx
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/ourorg/goui/pkg/tmpl"
+)
+
+// Command templates render in one of two ways.
+//
+// In argv mode, the default, the text of the template is split into words
+// like a shell would (whitespace, '...', "..." and \ escapes) while the
+// output of every {{action}} is one literal piece of a word, never split or
+// interpreted. The words run without a shell, so table cells cannot inject
+// commands. {{args .Selection}} expands a list into one word per element.
+//
+// In shell mode (Config.ShellMode) the rendered text runs through sh -c and
+// the template must quote values itself with {{quote .X}} or {{args .X}}.
+
+// Markers around action output in argv mode, and the forced word break
+// between elements of args. Data never contains them, they are stripped.
+const (
+	litStart  = '\x1e'
+	litEnd    = '\x1f'
+	wordBreak = '\x00'
+)
+
+// Rendered is a command template expanded for one run.
+type Rendered struct {
+	// Argv to start directly, nil in shell mode
+	Argv []string
+	// Line for sh -c in shell mode, the quoted argv otherwise
+	Line  string
+	Shell bool
+}
+
+// argv is what to start, wrapping shell mode lines in sh with shellFlag.
+func (r Rendered) argv(shellFlag string) []string {
+	if r.Shell {
+		return []string{"sh", shellFlag, r.Line}
+	}
+	return r.Argv
+}
+
+// argList is the output of args, already split into words.
+type argList string
+
+// Templates are cached per mode, argv mode ones with their tree rewritten.
+var (
+	argvTemplates  = tmpl.NewCache(commandFuncs(false), literalTemplates)
+	shellTemplates = tmpl.NewCache(commandFuncs(true), nil)
+)
+
+// RenderCommand expands tmpl with data in argv or shell mode. Templates are
+// strict: a missing key fails the command instead of running "<no value>".
+func RenderCommand(text string, data map[string]interface{}, shell bool) (Rendered, error) {
+	cache := argvTemplates
+	if shell {
+		cache = shellTemplates
+	}
+	out, err := cache.Render(text, data, tmpl.Strict)
+	if err != nil {
+		return Rendered{}, err
+	}
+	if shell {
+		return Rendered{Line: out, Shell: true}, nil
+	}
+	argv, err := splitWords(out)
+	if err != nil {
+		return Rendered{}, err
+	}
+	if len(argv) == 0 {
+		return Rendered{}, fmt.Errorf("template %q renders no command", text)
+	}
+	return Rendered{Argv: argv, Line: QuoteArgv(argv)}, nil
+}
+
+// commandFuncs adds quote and args to the shared library, see tmpl.Funcs.
+func commandFuncs(shell bool) template.FuncMap {
+	return template.FuncMap{
+		// quote makes a value one shell word, argv mode needs no quoting
+		"quote": func(v interface{}) string {
+			s := fmt.Sprint(v)
+			if shell {
+				return ShellQuote(s)
+			}
+			return s
+		},
+		// args expands a list into one word per element
+		"args": func(v interface{}) interface{} {
+			words := toStrings(v)
+			if shell {
+				return QuoteArgv(words)
+			}
+			var b strings.Builder
+			for i, w := range words {
+				if i > 0 {
+					b.WriteRune(wordBreak)
+				}
+				b.WriteString(literal(w))
+			}
+			return argList(b.String())
+		},
+		"_lit": func(v interface{}) interface{} {
+			if l, ok := v.(argList); ok {
+				return string(l)
+			}
+			return literal(fmt.Sprint(v))
+		},
+	}
+}
+
+func literalTemplates(t *template.Template) {
+	for _, tr := range t.Templates() {
+		if tr.Tree != nil && tr.Tree.Root != nil {
+			literalActions(tr.Tree, tr.Tree.Root)
+		}
+	}
+}
+
+// literalActions pipes the output of every action through _lit, the way
+// html/template adds its escapers.
+func literalActions(tree *parse.Tree, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			literalActions(tree, c)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return // {{$x := ...}} prints nothing
+		}
+		id := parse.NewIdentifier("_lit").SetTree(tree).SetPos(n.Position())
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Position(),
+			Args:     []parse.Node{id},
+		})
+	case *parse.IfNode:
+		literalActions(tree, n.List)
+		literalActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		literalActions(tree, n.List)
+		literalActions(tree, n.ElseList)
+	case *parse.WithNode:
+		literalActions(tree, n.List)
+		literalActions(tree, n.ElseList)
+	}
+}
+
+func literal(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == litStart || r == litEnd || r == wordBreak {
+			return -1
+		}
+		return r
+	}, s)
+	return string(litStart) + s + string(litEnd)
+}
+
+// splitWords splits rendered argv mode output into words.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, cur.String())
+			cur.Reset()
+			inWord = false
+		}
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == litStart:
+			inWord = true
+			for i++; i < len(rs) && rs[i] != litEnd; i++ {
+				cur.WriteRune(rs[i])
+			}
+		case r == wordBreak:
+			flush()
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '\\' && i+1 < len(rs):
+			i++
+			cur.WriteRune(rs[i])
+			inWord = true
+		case r == '\'' || r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(rs); i++ {
+				c := rs[i]
+				if c == r {
+					closed = true
+					break
+				}
+				switch {
+				case c == wordBreak:
+					cur.WriteRune(' ') // args inside quotes stays one word
+				case c == litStart:
+					for i++; i < len(rs) && rs[i] != litEnd; i++ {
+						cur.WriteRune(rs[i])
+					}
+				case c == '\\' && r == '"' && i+1 < len(rs) && strings.ContainsRune(`"\$`+"`", rs[i+1]):
+					i++
+					cur.WriteRune(rs[i])
+				default:
+					cur.WriteRune(c)
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated %c quote in command", r)
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	flush()
+	return words, nil
+}
+
+func toStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, x := range v {
+			out[i] = fmt.Sprint(x)
+		}
+		return out
+	case string:
+		return []string{v}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
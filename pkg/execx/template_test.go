@@ -0,0 +1,122 @@
+package execx
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Values a table cell or typed argument could carry to break out of its word.
+var injections = []struct {
+	name  string
+	value string
+}{
+	{"semicolon", "pod-1; rm -rf /"},
+	{"command substitution", "$(touch /tmp/pwned)"},
+	{"backticks", "`touch /tmp/pwned`"},
+	{"single quote", "it's'; id; echo '"},
+	{"double quote", `a" ; id ; echo "b`},
+	{"newline", "pod-1\nrm -rf /"},
+	{"leading dash", "-rf"},
+	{"pipe and redirect", "x | tee /etc/passwd > /dev/null &"},
+	{"variable", "$HOME ${PATH}"},
+	{"glob", "*"},
+	{"marker bytes", "a\x1eb\x1fc\x00d"},
+}
+
+func TestRenderCommandKeepsValuesLiteral(t *testing.T) {
+	templates := []struct {
+		name string
+		text string
+		want func(v string) []string
+	}{
+		{"bare", "kubectl delete pod {{.V}}", func(v string) []string { return []string{"kubectl", "delete", "pod", v} }},
+		{"quote func", "kubectl delete pod {{quote .V}}", func(v string) []string { return []string{"kubectl", "delete", "pod", v} }},
+		{"inside single quotes", "echo '{{.V}}'", func(v string) []string { return []string{"echo", v} }},
+		{"inside double quotes", `echo "{{.V}}"`, func(v string) []string { return []string{"echo", v} }},
+		{"joined to text", "grep --regexp={{.V}} log", func(v string) []string { return []string{"grep", "--regexp=" + v, "log"} }},
+		{"args", "echo {{args .L}}", func(v string) []string { return []string{"echo", v, v} }},
+	}
+	for _, tt := range templates {
+		for _, in := range injections {
+			t.Run(tt.name+"/"+in.name, func(t *testing.T) {
+				data := map[string]interface{}{"V": in.value, "L": []string{in.value, in.value}}
+				r, err := RenderCommand(tt.text, data, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := tt.want(stripMarkers(in.value))
+				if !reflect.DeepEqual(r.Argv, want) {
+					t.Errorf("argv = %q, want %q", r.Argv, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRenderCommandShellModeQuotes(t *testing.T) {
+	sh := lookSh(t)
+	for _, in := range injections {
+		if strings.ContainsRune(in.value, 0) {
+			continue // sh cannot carry NUL bytes
+		}
+		t.Run(in.name, func(t *testing.T) {
+			data := map[string]interface{}{"V": in.value, "L": []string{in.value, "x"}}
+			r, err := RenderCommand(`printf '%s\0' {{quote .V}} {{args .L}}`, data, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := runArgs(t, sh, r.Line)
+			want := []string{in.value, in.value, "x"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("sh split %q into %q, want %q", r.Line, got, want)
+			}
+		})
+	}
+}
+
+func TestSSHArgvKeepsTargetAndRemoteArgv(t *testing.T) {
+	sh := lookSh(t)
+	for _, in := range injections {
+		if strings.ContainsRune(in.value, 0) {
+			continue
+		}
+		t.Run(in.name, func(t *testing.T) {
+			argv := []string{"printf", `%s\0`, in.value}
+			cmd := sshArgv(Config{SSHHost: "web1", SSHUser: "ops"}, Options{}, argv)
+			want := []string{"ssh", "-o", "BatchMode=yes", "--", "ops@web1"}
+			if !reflect.DeepEqual(cmd[:len(want)], want) || len(cmd) != len(want)+1 {
+				t.Fatalf("ssh argv = %q, want %q and one remote line", cmd, want)
+			}
+			// the remote shell must split the line back into argv
+			if got := runArgs(t, sh, cmd[len(cmd)-1]); !reflect.DeepEqual(got, []string{in.value}) {
+				t.Errorf("remote line %q ran as %q, want %q", cmd[len(cmd)-1], got, in.value)
+			}
+		})
+	}
+}
+
+func stripMarkers(s string) string {
+	return strings.NewReplacer("\x1e", "", "\x1f", "", "\x00", "").Replace(s)
+}
+
+func lookSh(t *testing.T) string {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh in PATH")
+	}
+	return sh
+}
+
+// runArgs runs line, which must print its arguments NUL terminated, and
+// returns what it printed.
+func runArgs(t *testing.T, sh, line string) []string {
+	t.Helper()
+	out, err := exec.Command(sh, "-c", line).Output()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v", line, err)
+	}
+	parts := strings.Split(string(out), "\x00")
+	return parts[:len(parts)-1]
+}
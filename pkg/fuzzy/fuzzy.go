@@ -0,0 +1,171 @@
+package fuzzy
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Scoring follows fzf's v1 algorithm: every matched rune scores, runs of
+// consecutive matches and matches at word starts score extra, gaps cost.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	bonusBoundary    = 8
+	bonusCamel       = 7
+	bonusConsecutive = 4
+	bonusFirstChar   = 2 // multiplier for the bonus of the first pattern rune
+)
+
+// Result describes a successful match. Positions are rune indexes into the
+// text, ascending, one per pattern rune, so renderers can highlight them.
+type Result struct {
+	Score     int
+	Positions []int
+}
+
+// Match reports whether pattern is a subsequence of text and how well it
+// matches. Matching is case-insensitive unless pattern has an upper case rune.
+// An empty pattern matches everything with score 0.
+func Match(pattern, text string) (Result, bool) {
+	pat := []rune(pattern)
+	if len(pat) == 0 {
+		return Result{}, true
+	}
+	txt := []rune(text)
+	caseSensitive := hasUpper(pat)
+	eq := func(p, t rune) bool {
+		if caseSensitive {
+			return p == t
+		}
+		return unicode.ToLower(p) == unicode.ToLower(t)
+	}
+
+	// Forward scan finds the first window that contains the pattern
+	pi, end := 0, -1
+	for ti := 0; ti < len(txt); ti++ {
+		if eq(pat[pi], txt[ti]) {
+			pi++
+			if pi == len(pat) {
+				end = ti
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return Result{}, false
+	}
+
+	// Backward scan from the end tightens the window to its latest start
+	start := end
+	pi = len(pat) - 1
+	for ti := end; ti >= 0; ti-- {
+		if eq(pat[pi], txt[ti]) {
+			pi--
+			if pi < 0 {
+				start = ti
+				break
+			}
+		}
+	}
+
+	return score(pat, txt, start, end, eq), true
+}
+
+func score(pat, txt []rune, start, end int, eq func(p, t rune) bool) Result {
+	res := Result{Positions: make([]int, 0, len(pat))}
+	pi := 0
+	inGap := false
+	consecutive := 0
+	firstBonus := 0
+	for ti := start; ti <= end && pi < len(pat); ti++ {
+		if !eq(pat[pi], txt[ti]) {
+			if inGap {
+				res.Score += scoreGapExtension
+			} else {
+				res.Score += scoreGapStart
+			}
+			inGap = true
+			consecutive = 0
+			firstBonus = 0
+			continue
+		}
+		b := bonusAt(txt, ti)
+		if consecutive == 0 {
+			firstBonus = b
+		} else {
+			// A run keeps the bonus of the boundary it started on
+			if b < firstBonus {
+				b = firstBonus
+			}
+			if b < bonusConsecutive {
+				b = bonusConsecutive
+			}
+		}
+		if pi == 0 {
+			b *= bonusFirstChar
+		}
+		res.Score += scoreMatch + b
+		res.Positions = append(res.Positions, ti)
+		inGap = false
+		consecutive++
+		pi++
+	}
+	return res
+}
+
+// bonusAt rewards matches that start a word: after a separator, at a
+// lower to upper case change, or at a letter following a digit.
+func bonusAt(txt []rune, i int) int {
+	if i == 0 {
+		return bonusBoundary
+	}
+	prev, cur := txt[i-1], txt[i]
+	switch {
+	case isSeparator(prev) && !isSeparator(cur):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return bonusCamel
+	case unicode.IsDigit(prev) && unicode.IsLetter(cur):
+		return bonusCamel
+	}
+	return 0
+}
+
+func isSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', '-', '_', '/', '\\', '.', ':', ',', ';', '|', '(', ')', '[', ']', '@', '=':
+		return true
+	}
+	return false
+}
+
+func hasUpper(rs []rune) bool {
+	for _, r := range rs {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranked is a candidate that matched, with its original index.
+type Ranked struct {
+	Index int
+	Text  string
+	Result
+}
+
+// Rank matches pattern against all candidates and returns the matches,
+// best score first. Ties keep the candidates' original order.
+func Rank(pattern string, candidates []string) []Ranked {
+	var out []Ranked
+	for i, c := range candidates {
+		if r, ok := Match(pattern, c); ok {
+			out = append(out, Ranked{Index: i, Text: c, Result: r})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
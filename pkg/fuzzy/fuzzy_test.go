@@ -0,0 +1,94 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRankPrefersPrefixAndBoundaries(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		candidates []string
+		best       string
+	}{
+		{"kp", []string{"backup", "kube-proxy"}, "kube-proxy"},
+		{"pod", []string{"spread-on-disk", "pods"}, "pods"},
+		{"po", []string{"deployment", "kube/pods"}, "kube/pods"},
+		{"sv", []string{"sliver", "statefulSetView"}, "statefulSetView"},
+		{"ns", []string{"namespaces", "gns"}, "namespaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := Rank(tt.pattern, tt.candidates)
+			if len(got) != len(tt.candidates) {
+				t.Fatalf("Rank(%q) matched %d of %d", tt.pattern, len(got), len(tt.candidates))
+			}
+			if got[0].Text != tt.best {
+				t.Errorf("Rank(%q) best = %q (%d), want %q (%d)", tt.pattern, got[0].Text, got[0].Score, tt.best, got[1].Score)
+			}
+		})
+	}
+}
+
+func TestRankKeepsOrderOnTies(t *testing.T) {
+	got := Rank("a", []string{"ab", "ac", "ad"})
+	for i, r := range got {
+		if r.Index != i {
+			t.Errorf("tie %d has index %d, want %d", i, r.Index, i)
+		}
+	}
+}
+
+func TestEmptyPattern(t *testing.T) {
+	r, ok := Match("", "anything")
+	if !ok || r.Score != 0 || len(r.Positions) != 0 {
+		t.Errorf("Match(\"\") = %+v, %v, want a zero match", r, ok)
+	}
+	if got := Rank("", []string{"b", "a"}); len(got) != 2 || got[0].Text != "b" {
+		t.Errorf("Rank(\"\") = %+v, want all candidates in order", got)
+	}
+}
+
+func TestCase(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		ok            bool
+	}{
+		{"pod", "POD", true},  // lower case pattern ignores case
+		{"Pod", "pod", false}, // an upper case rune makes it case sensitive
+		{"Pod", "my-Pod", true},
+		{"ÉTÉ", "été", false},
+		{"été", "ÉTÉ", true},
+		{"xyz", "pods", false},
+		{"podss", "pods", false}, // longer than the text
+	}
+	for _, tt := range tests {
+		if _, ok := Match(tt.pattern, tt.text); ok != tt.ok {
+			t.Errorf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+		}
+	}
+}
+
+func TestPositionsAreRuneIndexes(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		want          []int
+	}{
+		{"pd", "pod", []int{0, 2}},
+		{"zü", "größe-zürich", []int{6, 7}},
+		{"日本", "にほん日本語", []int{3, 4}},
+		{"ab", "🙂a🙂b", []int{1, 3}},
+		// the window is tightened to the latest start before the match end
+		{"ab", "a-xab", []int{3, 4}},
+	}
+	for _, tt := range tests {
+		r, ok := Match(tt.pattern, tt.text)
+		if !ok {
+			t.Errorf("Match(%q, %q) did not match", tt.pattern, tt.text)
+			continue
+		}
+		if !reflect.DeepEqual(r.Positions, tt.want) {
+			t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, r.Positions, tt.want)
+		}
+	}
+}
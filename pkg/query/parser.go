@@ -0,0 +1,313 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+type tokKind int
+
+const (
+	tokTerm tokKind = iota
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokKind
+	text string // source text, for error messages
+
+	// tokTerm
+	field string // empty for plain terms
+	op    string
+	value string
+	quote bool // value was "quoted"
+	regex bool // value was /regex/
+}
+
+// comparison operators, longest first so ">=" wins over ">"
+var ops = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+func tokenize(q string) ([]token, error) {
+	rs := []rune(q)
+	var toks []token
+	i := 0
+	for i < len(rs) {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{kind: tokLParen, text: "("})
+			i++
+		case r == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")"})
+			i++
+		case r == '|':
+			toks = append(toks, token{kind: tokOr, text: "|"})
+			i++
+		case r == '&':
+			toks = append(toks, token{kind: tokAnd, text: "&"})
+			i++
+		case (r == '-' || r == '!') && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) && rs[i+1] != '=':
+			toks = append(toks, token{kind: tokNot, text: string(r)})
+			i++
+		case r == '"':
+			val, n, err := delimited(rs[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokTerm, text: string(rs[i : i+n]), value: val, quote: true})
+			i += n
+		case r == '/' && isRegex(rs[i:]):
+			val, n, _ := delimited(rs[i:])
+			toks = append(toks, token{kind: tokTerm, text: string(rs[i : i+n]), value: val, regex: true})
+			i += n
+		default:
+			t, n, err := word(rs[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i += n
+		}
+	}
+	return toks, nil
+}
+
+// delimited reads a "quoted" or /regex/ value starting at rs[0], honoring
+// backslash escapes of the delimiter, and returns it with the runes consumed.
+func delimited(rs []rune) (string, int, error) {
+	delim := rs[0]
+	var b strings.Builder
+	for i := 1; i < len(rs); i++ {
+		if rs[i] == '\\' && i+1 < len(rs) && rs[i+1] == delim {
+			b.WriteRune(delim)
+			i++
+			continue
+		}
+		if rs[i] == delim {
+			return b.String(), i + 1, nil
+		}
+		b.WriteRune(rs[i])
+	}
+	return "", 0, fmt.Errorf("unterminated %c in query", delim)
+}
+
+// isRegex reports whether rs starts with a closed /regex/ that ends the
+// word, so paths like /var/log or a lone / stay plain terms.
+func isRegex(rs []rune) bool {
+	_, n, err := delimited(rs)
+	return err == nil && n > 2 && (n == len(rs) || wordEnd(rs[n]))
+}
+
+func wordEnd(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' }
+
+// word reads a plain term or a field comparison like cpu>50 or name:"a b".
+func word(rs []rune) (token, int, error) {
+	end := 0
+	for end < len(rs) && !wordEnd(rs[end]) {
+		end++
+	}
+	text := string(rs[:end])
+	switch text {
+	case "AND":
+		return token{kind: tokAnd, text: text}, end, nil
+	case "OR":
+		return token{kind: tokOr, text: text}, end, nil
+	case "NOT":
+		return token{kind: tokNot, text: text}, end, nil
+	}
+
+	field, op, at := splitField(rs[:end])
+	if op == "" {
+		return token{kind: tokTerm, text: text, value: text}, end, nil
+	}
+	t := token{kind: tokTerm, field: field, op: op}
+	valStart := at + len(op)
+	if valStart < len(rs) && (rs[valStart] == '"' || rs[valStart] == '/' && isRegex(rs[valStart:])) {
+		val, n, err := delimited(rs[valStart:])
+		if err != nil {
+			return token{}, 0, err
+		}
+		t.value, t.quote, t.regex = val, rs[valStart] == '"', rs[valStart] == '/'
+		end = valStart + n
+	} else {
+		t.value = string(rs[valStart:end])
+	}
+	t.text = string(rs[:end])
+	return t, end, nil
+}
+
+// splitField finds the first operator preceded by a field name. Terms whose
+// left side is all digits, like 10:30, stay plain terms.
+func splitField(rs []rune) (field, op string, at int) {
+	for i := 1; i < len(rs); i++ {
+		rest := string(rs[i:])
+		for _, o := range ops {
+			if !strings.HasPrefix(rest, o) {
+				continue
+			}
+			field = string(rs[:i])
+			if strings.Trim(field, "0123456789") == "" {
+				return "", "", 0
+			}
+			return field, o, i
+		}
+	}
+	return "", "", 0
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	cols []Column
+}
+
+func (p *parser) done() bool  { return p.pos >= len(p.toks) }
+func (p *parser) peek() token { return p.toks[p.pos] }
+func (p *parser) next() token { t := p.toks[p.pos]; p.pos++; return t }
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() && p.peek().kind == tokOr {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() {
+		switch p.peek().kind {
+		case tokOr, tokRParen:
+			return l, nil
+		case tokAnd:
+			p.next()
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.done() {
+		return nil, fmt.Errorf("query ends unexpectedly")
+	}
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing )")
+		}
+		return n, nil
+	case tokTerm:
+		return p.term(t)
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (p *parser) term(t token) (node, error) {
+	if t.field == "" {
+		n := anyNode{term: t.value, exact: t.quote}
+		if t.regex {
+			re, err := regexp.Compile(t.value)
+			if err != nil {
+				return nil, fmt.Errorf("bad regex /%s/: %v", t.value, err)
+			}
+			n.re = re
+		}
+		return n, nil
+	}
+
+	col, typ, ok := p.column(t.field)
+	if !ok {
+		// Not a column, so text like host:8080 or http://x is searched as is
+		text := t.text
+		if t.quote {
+			text = t.field + t.op + t.value
+		}
+		return anyNode{term: text, exact: true}, nil
+	}
+	n := fieldNode{col: col, op: t.op}
+	if t.regex {
+		if t.op != ":" {
+			return nil, fmt.Errorf("regex needs ':' in %q", t.text)
+		}
+		re, err := regexp.Compile(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex /%s/: %v", t.value, err)
+		}
+		n.re = re
+		return n, nil
+	}
+	if t.value == "" {
+		return nil, fmt.Errorf("missing value in %q", t.text)
+	}
+	if t.op == ":" {
+		n.lit = literal{typ: spec.ColString, raw: t.value}
+		return n, nil
+	}
+	if typ == "" {
+		typ = inferType(t.value)
+	}
+	lit, err := newLiteral(typ, t.value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.field, err)
+	}
+	n.lit = lit
+	return n, nil
+}
+
+// column resolves a field name ignoring case, spaces, dashes and underscores.
+func (p *parser) column(field string) (int, string, bool) {
+	want := normalize(field)
+	for i, c := range p.cols {
+		if normalize(c.Name) == want {
+			return i, c.Type, true
+		}
+	}
+	return 0, "", false
+}
+
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
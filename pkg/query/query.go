@@ -0,0 +1,231 @@
+// Package query implements the search mode query language for tables.
+//
+//	nginx                 fuzzy match against any cell
+//	"exact text"          case-insensitive substring of any cell
+//	/^web-\d+/            regular expression against any cell
+//	status:running        column contains value (value may be /regex/)
+//	host:8080             no such column, substring of any cell
+//	status=running        column equals value, != for not equal
+//	cpu>50  age<1h        typed comparison, also >= and <=
+//	-name:test  NOT x     negation
+//	a b  a AND b          both, juxtaposition means AND
+//	a OR b  a | b         either, binds weaker than AND
+//	(a OR b) c            grouping
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/fuzzy"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// Column describes a table column the query can refer to by name.
+type Column struct {
+	Name string
+	Type string // one of the spec.Col* types, empty to infer from the query
+}
+
+// Query is a compiled query bound to a set of columns.
+type Query struct {
+	root node
+}
+
+// Compile parses q and resolves its column references against cols.
+// An empty query matches every row.
+func Compile(q string, cols []Column) (*Query, error) {
+	toks, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, cols: cols}
+	if len(toks) == 0 {
+		return &Query{}, nil
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return &Query{root: root}, nil
+}
+
+// Match reports whether the row values satisfy the query.
+func (q *Query) Match(values []string) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+	return q.root.match(values)
+}
+
+// Highlight returns rune positions per value matched by the plain terms of
+// the query, so renderers can highlight them like fuzzy search results.
+func (q *Query) Highlight(values []string) [][]int {
+	if q == nil || q.root == nil {
+		return nil
+	}
+	var pos [][]int
+	q.root.highlight(values, func(i int, p []int) {
+		if pos == nil {
+			pos = make([][]int, len(values))
+		}
+		pos[i] = mergePositions(pos[i], p)
+	})
+	return pos
+}
+
+// FromTable builds the column list from table headers and schema.
+func FromTable(headers []string, schema []spec.ColMeta) []Column {
+	cols := make([]Column, len(headers))
+	for i, h := range headers {
+		cols[i].Name = h
+		if i < len(schema) {
+			cols[i].Type = schema[i].Type
+		}
+	}
+	return cols
+}
+
+// node is one boolean term of the query tree.
+type node interface {
+	match(values []string) bool
+	highlight(values []string, emit func(col int, pos []int))
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ n node }
+
+func (n andNode) match(v []string) bool { return n.l.match(v) && n.r.match(v) }
+func (n orNode) match(v []string) bool  { return n.l.match(v) || n.r.match(v) }
+func (n notNode) match(v []string) bool { return !n.n.match(v) }
+
+func (n andNode) highlight(v []string, emit func(int, []int)) {
+	n.l.highlight(v, emit)
+	n.r.highlight(v, emit)
+}
+func (n orNode) highlight(v []string, emit func(int, []int)) {
+	n.l.highlight(v, emit)
+	n.r.highlight(v, emit)
+}
+
+// Negated terms matched nothing worth highlighting
+func (n notNode) highlight([]string, func(int, []int)) {}
+
+// anyNode matches a plain term against every cell.
+type anyNode struct {
+	term  string
+	exact bool // quoted: substring instead of fuzzy
+	re    *regexp.Regexp
+}
+
+func (n anyNode) cell(s string) ([]int, bool) {
+	switch {
+	case n.re != nil:
+		return nil, n.re.MatchString(s)
+	case n.exact:
+		return substringPositions(s, n.term)
+	default:
+		r, ok := fuzzy.Match(n.term, s)
+		return r.Positions, ok
+	}
+}
+
+func (n anyNode) match(values []string) bool {
+	for _, v := range values {
+		if _, ok := n.cell(v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (n anyNode) highlight(values []string, emit func(int, []int)) {
+	for i, v := range values {
+		if p, ok := n.cell(v); ok && len(p) > 0 {
+			emit(i, p)
+		}
+	}
+}
+
+// fieldNode compares one column against a literal.
+type fieldNode struct {
+	col int
+	op  string
+	lit literal
+	re  *regexp.Regexp
+}
+
+func (n fieldNode) match(values []string) bool {
+	if n.col >= len(values) {
+		return false
+	}
+	cell := values[n.col]
+	switch n.op {
+	case ":":
+		if n.re != nil {
+			return n.re.MatchString(cell)
+		}
+		return strings.Contains(strings.ToLower(cell), strings.ToLower(n.lit.raw))
+	}
+	c, ok := n.lit.compareCell(cell)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+func (n fieldNode) highlight(values []string, emit func(int, []int)) {
+	if n.op != ":" || n.re != nil || n.col >= len(values) {
+		return
+	}
+	if p, ok := substringPositions(values[n.col], n.lit.raw); ok {
+		emit(n.col, p)
+	}
+}
+
+func substringPositions(s, sub string) ([]int, bool) {
+	ls, lsub := []rune(strings.ToLower(s)), []rune(strings.ToLower(sub))
+	for i := 0; i+len(lsub) <= len(ls); i++ {
+		if string(ls[i:i+len(lsub)]) == string(lsub) {
+			p := make([]int, len(lsub))
+			for j := range p {
+				p[j] = i + j
+			}
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func mergePositions(a, b []int) []int {
+	seen := map[int]bool{}
+	var out []int
+	for _, p := range append(append([]int{}, a...), b...) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Ints(out) // renderers expect ascending positions
+	return out
+}
@@ -0,0 +1,130 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+var testCols = []Column{
+	{Name: "Name"},
+	{Name: "Status"},
+	{Name: "CPU", Type: spec.ColNumber},
+	{Name: "Age", Type: spec.ColDuration},
+	{Name: "Created At"},
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		q       string
+		wantErr bool
+	}{
+		{"", false},
+		{"nginx", false},
+		{`"a b"`, false},
+		{`"a b`, true},
+		{"/^web-\\d+/", false},
+		{"/[/", true},
+		{"/var/log", false},
+		{"/tmp", false},
+		{"/", false},
+		{"(a OR b) c", false},
+		{"(a OR b", true},
+		{"a )", true},
+		{"NOT", true},
+		{"cpu>", true},
+		{"cpu>abc", true},
+		{"cpu>50", false},
+		{"status=/x/", true},
+		{"status:/ru[/", true},
+		{"host:8080", false},
+		{"http://x", false},
+		{"created_at:2024", false},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.q, testCols)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Compile(%q) error = %v, want error %v", tt.q, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rows := map[string][]string{
+		"web":   {"web-1", "Running", "75", "3d", "2024-01-02"},
+		"db":    {"db-main", "Pending", "5", "2h", "2024-03-04"},
+		"proxy": {"proxy /var/log", "Running", "nan", "10m", "http://x:8080"},
+	}
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", []string{"db", "proxy", "web"}},
+		{"wb", []string{"web"}}, // fuzzy
+		{`"b-m"`, []string{"db"}},
+		{"/^web-\\d+$/", []string{"web"}},
+		{"/var/log", []string{"proxy"}},
+		{"status:run", []string{"proxy", "web"}},
+		{"status=running", []string{"proxy", "web"}},
+		{"status!=running", []string{"db"}},
+		{"cpu>50", []string{"web"}},
+		{"cpu<=5", []string{"db"}},
+		{"age>1h", []string{"db", "web"}},
+		{"age<1h", []string{"proxy"}},
+		{"-name:web", []string{"db", "proxy"}},
+		{"NOT status:running", []string{"db"}},
+		{"status:running cpu>50", []string{"web"}},
+		{"status:pending OR cpu>50", []string{"db", "web"}},
+		{"status:pending | name:proxy", []string{"db", "proxy"}},
+		{"(db OR web) status:running", []string{"web"}},
+		{"name:/^db/", []string{"db"}},
+		{"http://x", []string{"proxy"}},
+		{"x:8080", []string{"proxy"}},
+		{"host:8080", nil},
+		{"createdat:2024-03", []string{"db"}},
+	}
+	for _, tt := range tests {
+		q, err := Compile(tt.q, testCols)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.q, err)
+			continue
+		}
+		var got []string
+		for _, k := range []string{"db", "proxy", "web"} {
+			if q.Match(rows[k]) {
+				got = append(got, k)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q matched %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestInferTypeRejectsNaNAndInf(t *testing.T) {
+	for _, s := range []string{"NaN", "nan", "Inf", "+Inf", "-inf", "infinity"} {
+		if _, ok := ParseNumber(s); ok {
+			t.Errorf("ParseNumber(%q) accepted", s)
+		}
+		if got := inferType(s); got != spec.ColString {
+			t.Errorf("inferType(%q) = %s, want %s", s, got, spec.ColString)
+		}
+	}
+	for _, s := range []string{"42", "-1.5", "1,024", "42%"} {
+		if _, ok := ParseNumber(s); !ok {
+			t.Errorf("ParseNumber(%q) rejected", s)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q, err := Compile(`status:run "web"`, testCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := q.Highlight([]string{"web-1", "Running"})
+	if !reflect.DeepEqual(pos, [][]int{{0, 1, 2}, {0, 1, 2}}) {
+		t.Errorf("highlight = %v", pos)
+	}
+}
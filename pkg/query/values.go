@@ -0,0 +1,392 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// ParseNumber accepts plain numbers and common decorations like "42%" or "1,024".
+// NaN and infinities are not numbers here, so cells reading "nan" or "Inf"
+// stay strings.
+func ParseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "%")
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// ParseDuration extends time.ParseDuration with the d, w and y units that
+// tools like kubectl print for ages, e.g. "3d4h" or "2w".
+func ParseDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, true
+	}
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+			i++
+		}
+		if i == 0 {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, false
+		}
+		s = s[i:]
+		j := 0
+		for j < len(s) && !(s[j] >= '0' && s[j] <= '9') {
+			j++
+		}
+		unit, ok := durationUnits[s[:j]]
+		if !ok {
+			return 0, false
+		}
+		total += time.Duration(n * float64(unit))
+		s = s[j:]
+	}
+	return total, true
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123,
+	time.ANSIC,
+}
+
+// ParseTime tries the timestamp layouts commonly printed by CLI tools.
+func ParseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+var sizeUnits = map[string]float64{
+	"":  1,
+	"k": 1e3, "m": 1e6, "g": 1e9, "t": 1e12, "p": 1e15, "e": 1e18,
+	"ki": 1 << 10, "mi": 1 << 20, "gi": 1 << 30, "ti": 1 << 40, "pi": 1 << 50, "ei": 1 << 60,
+}
+
+// ParseSize reads human readable sizes in bytes: 12Mi, 1.5G, 512KB, 3 GiB.
+// A plain number is a byte count.
+func ParseSize(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := strings.ToLower(strings.TrimSpace(s[i:]))
+	if unit != "b" {
+		unit = strings.TrimSuffix(unit, "b")
+	}
+	if unit == "b" {
+		unit = ""
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, false
+	}
+	return n * mult, true
+}
+
+// Semver is a parsed semantic version, the leading v is optional.
+type Semver struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseSemver reads versions like v1.2.3, 1.2 or 1.2.3-rc.1+build.
+func ParseSemver(s string) (Semver, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v Semver
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Pre = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, false
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*nums[i] = n
+	}
+	return v, true
+}
+
+// CompareSemver orders versions, a pre-release before its release.
+func CompareSemver(a, b Semver) int {
+	for _, c := range [][2]int{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if c[0] != c[1] {
+			return cmpOrdered(int64(c[0]), int64(c[1]))
+		}
+	}
+	switch {
+	case a.Pre == b.Pre:
+		return 0
+	case a.Pre == "":
+		return 1
+	case b.Pre == "":
+		return -1
+	}
+	return NaturalCompare(a.Pre, b.Pre)
+}
+
+// NaturalCompare orders strings case-insensitively with digit runs compared
+// as numbers, so "item2" sorts before "item10".
+func NaturalCompare(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		ca, cb := chunk(a), chunk(b)
+		a, b = a[len(ca):], b[len(cb):]
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				return cmpOrdered(int64(len(na)), int64(len(nb)))
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return cmpOrdered(int64(len(a)), int64(len(b)))
+}
+
+// chunk returns the leading run of digits or non-digits.
+func chunk(s string) string {
+	d := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == d {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// inferType guesses the type of a value, used for query literals and for
+// columns without a declared type. Falls back to ColString.
+func inferType(lit string) string {
+	if _, ok := ParseNumber(lit); ok {
+		return spec.ColNumber
+	}
+	if _, ok := ParseDuration(lit); ok {
+		return spec.ColDuration
+	}
+	if _, ok := ParseSize(lit); ok {
+		return spec.ColSize
+	}
+	if _, ok := ParseTime(lit); ok {
+		return spec.ColTime
+	}
+	if _, ok := ParseSemver(lit); ok {
+		return spec.ColSemver
+	}
+	return spec.ColString
+}
+
+// InferColumnType picks the type most non-empty values parse as, when it
+// covers at least half of them. Otherwise the column is ColString.
+func InferColumnType(values []string) string {
+	counts := map[string]int{}
+	total := 0
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		total++
+		counts[inferType(v)]++
+	}
+	best, n := spec.ColString, 0
+	for _, typ := range []string{spec.ColNumber, spec.ColDuration, spec.ColSize, spec.ColTime, spec.ColSemver} {
+		if counts[typ] > n {
+			best, n = typ, counts[typ]
+		}
+	}
+	if n*2 < total {
+		return spec.ColString
+	}
+	return best
+}
+
+// Compare orders two cell values as the given column type. It returns false
+// when either value cannot be parsed as that type. An empty type picks the
+// first type both values parse as, ending with natural string order.
+func Compare(typ, a, b string) (int, bool) {
+	if typ == "" {
+		ta := inferType(a)
+		if ta == inferType(b) {
+			typ = ta
+		} else {
+			typ = spec.ColString
+		}
+	}
+	switch typ {
+	case spec.ColNumber:
+		x, ok1 := ParseNumber(a)
+		y, ok2 := ParseNumber(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return cmpOrdered(x, y), true
+	case spec.ColSize:
+		x, ok1 := ParseSize(a)
+		y, ok2 := ParseSize(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return cmpOrdered(x, y), true
+	case spec.ColDuration:
+		x, ok1 := ParseDuration(a)
+		y, ok2 := ParseDuration(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return cmpOrdered(x, y), true
+	case spec.ColTime:
+		x, ok1 := ParseTime(a)
+		y, ok2 := ParseTime(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return cmpOrdered(x.UnixNano(), y.UnixNano()), true
+	case spec.ColSemver:
+		x, ok1 := ParseSemver(a)
+		y, ok2 := ParseSemver(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return CompareSemver(x, y), true
+	default:
+		return NaturalCompare(a, b), true
+	}
+}
+
+func cmpOrdered[T int64 | float64 | time.Duration](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// literal is a query value converted once to the column type it is compared as.
+type literal struct {
+	typ string
+	raw string
+	num float64
+	dur time.Duration
+	at  time.Time
+	ver Semver
+	age bool // a duration compared against a time column, e.g. created<1h
+}
+
+func newLiteral(typ, raw string) (literal, error) {
+	l := literal{typ: typ, raw: raw}
+	var ok bool
+	switch typ {
+	case spec.ColNumber:
+		l.num, ok = ParseNumber(raw)
+	case spec.ColSize:
+		l.num, ok = ParseSize(raw)
+	case spec.ColDuration:
+		l.dur, ok = ParseDuration(raw)
+	case spec.ColSemver:
+		l.ver, ok = ParseSemver(raw)
+	case spec.ColTime:
+		if l.at, ok = ParseTime(raw); !ok {
+			l.dur, ok = ParseDuration(raw)
+			l.age = ok
+		}
+	default:
+		ok = true
+	}
+	if !ok {
+		return l, fmt.Errorf("%q is not a valid %s", raw, typ)
+	}
+	return l, nil
+}
+
+// compareCell orders a cell against the literal, false if the cell does not parse.
+func (l literal) compareCell(cell string) (int, bool) {
+	switch l.typ {
+	case spec.ColNumber:
+		x, ok := ParseNumber(cell)
+		return cmpOrdered(x, l.num), ok
+	case spec.ColSize:
+		x, ok := ParseSize(cell)
+		return cmpOrdered(x, l.num), ok
+	case spec.ColDuration:
+		x, ok := ParseDuration(cell)
+		return cmpOrdered(x, l.dur), ok
+	case spec.ColSemver:
+		v, ok := ParseSemver(cell)
+		return CompareSemver(v, l.ver), ok
+	case spec.ColTime:
+		t, ok := ParseTime(cell)
+		if !ok {
+			return 0, false
+		}
+		if l.age {
+			return cmpOrdered(time.Since(t), l.dur), true
+		}
+		return cmpOrdered(t.UnixNano(), l.at.UnixNano()), true
+	default:
+		return NaturalCompare(cell, l.raw), true
+	}
+}
@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces redacted values.
+const Mask = "****"
+
+// minSecretLen keeps short values, which would mask half of every line,
+// out of redaction.
+const minSecretLen = 4
+
+// Redactor replaces known secret values with Mask.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{values: map[string]bool{}}
+}
+
+// Add registers a value to redact from now on.
+func (r *Redactor) Add(value string) {
+	if len(value) < minSecretLen {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[value] {
+		return
+	}
+	r.values[value] = true
+
+	// longest first so a secret containing another one is masked whole
+	vals := make([]string, 0, len(r.values))
+	for v := range r.values {
+		vals = append(vals, v)
+	}
+	sort.Slice(vals, func(i, j int) bool { return len(vals[i]) > len(vals[j]) })
+	pairs := make([]string, 0, 2*len(vals))
+	for _, v := range vals {
+		pairs = append(pairs, v, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with every known value masked.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	rep := r.replacer
+	r.mu.RUnlock()
+	if rep == nil || s == "" {
+		return s
+	}
+	return rep.Replace(s)
+}
+
+// Hook is a logrus hook that redacts messages and string fields.
+type Hook struct {
+	Redactor *Redactor
+}
+
+// InstallHook adds a Hook for Default's redactor to log, once per logger.
+func InstallHook(log *logrus.Logger) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if hooked[log] {
+		return
+	}
+	hooked[log] = true
+	log.AddHook(Hook{Redactor: Default.redactor})
+}
+
+var (
+	hooksMu sync.Mutex
+	hooked  = map[*logrus.Logger]bool{}
+)
+
+func (Hook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h Hook) Fire(e *logrus.Entry) error {
+	e.Message = h.Redactor.Redact(e.Message)
+	for k, v := range e.Data {
+		switch v := v.(type) {
+		case string:
+			e.Data[k] = h.Redactor.Redact(v)
+		case error:
+			e.Data[k] = h.Redactor.Redact(v.Error())
+		case fmt.Stringer:
+			e.Data[k] = h.Redactor.Redact(v.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package secret resolves secrets for command templates and keeps track of
+// their values so logs, history, info messages and specs can redact them.
+//
+// Templates refer to secrets as scheme:key, e.g. {{secret "env:GH_TOKEN"}},
+// {{secret "file:db-password"}} or {{secret "keyring:prod/api"}}.
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Provider looks secrets up by key within its scheme.
+type Provider interface {
+	Scheme() string
+	Get(key string) (string, error)
+}
+
+// ErrNotFound is returned by providers that do not know a key.
+var ErrNotFound = errors.New("secret not found")
+
+// Env reads environment variables, optionally under a prefix.
+type Env struct {
+	Prefix string
+}
+
+func (Env) Scheme() string { return "env" }
+
+func (p Env) Get(key string) (string, error) {
+	v, ok := os.LookupEnv(p.Prefix + key)
+	if !ok {
+		return "", fmt.Errorf("%w: env %s", ErrNotFound, p.Prefix+key)
+	}
+	return v, nil
+}
+
+// File reads one secret per file below Dir, trailing newlines trimmed, the
+// layout of docker and kubernetes secret mounts.
+type File struct {
+	Dir string
+}
+
+func (File) Scheme() string { return "file" }
+
+func (p File) Get(key string) (string, error) {
+	path := filepath.Join(p.Dir, filepath.Clean("/"+key))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Keyring is a stand-in for the OS keyring: a JSON file only the user can
+// read. Set and Delete write it through.
+type Keyring struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (*Keyring) Scheme() string { return "keyring" }
+
+func (k *Keyring) Get(key string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	items, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := items[key]
+	if !ok {
+		return "", fmt.Errorf("%w: keyring %s", ErrNotFound, key)
+	}
+	return v, nil
+}
+
+func (k *Keyring) Set(key, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	items, err := k.load()
+	if err != nil {
+		return err
+	}
+	items[key] = value
+	return k.save(items)
+}
+
+func (k *Keyring) Delete(key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	items, err := k.load()
+	if err != nil {
+		return err
+	}
+	delete(items, key)
+	return k.save(items)
+}
+
+func (k *Keyring) load() (map[string]string, error) {
+	items := map[string]string{}
+	data, err := os.ReadFile(k.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("keyring %s: %w", k.Path, err)
+	}
+	return items, nil
+}
+
+func (k *Keyring) save(items map[string]string) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0700); err != nil {
+		return err
+	}
+	tmp := k.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.Path)
+}
+
+// Resolver dispatches scheme:key references to providers and remembers
+// every value it hands out in its Redactor.
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+	redactor  *Redactor
+}
+
+func NewResolver(providers ...Provider) *Resolver {
+	r := &Resolver{providers: map[string]Provider{}, redactor: NewRedactor()}
+	for _, p := range providers {
+		r.Add(p)
+	}
+	return r
+}
+
+// Add registers p, replacing a provider with the same scheme.
+func (r *Resolver) Add(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Scheme()] = p
+}
+
+func (r *Resolver) Redactor() *Redactor {
+	return r.redactor
+}
+
+// Get resolves a scheme:key reference, a bare key is looked up in env.
+func (r *Resolver) Get(ref string) (string, error) {
+	scheme, key, ok := strings.Cut(ref, ":")
+	if !ok {
+		scheme, key = "env", ref
+	}
+	r.mu.RLock()
+	p, found := r.providers[scheme]
+	r.mu.RUnlock()
+	if !found {
+		return "", fmt.Errorf("no secret provider for %q", scheme)
+	}
+	v, err := p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	r.redactor.Add(v)
+	return v, nil
+}
+
+// Default serves the secret template function and the redaction the
+// engine applies. Apps add their file and keyring providers to it.
+var Default = NewResolver(Env{})
+
+// Lookup resolves ref with Default.
+func Lookup(ref string) (string, error) {
+	return Default.Get(ref)
+}
+
+// Redact hides the secrets Default handed out so far.
+func Redact(s string) string {
+	return Default.redactor.Redact(s)
+}
@@ -1,16 +1,27 @@
 package service
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/secret"
 	"github.com/ourorg/goui/pkg/spec"
 )
 
 const (
 	stateAliases = -101
 	stateHelp    = -102
+	stateHistory = -103
+
+	// StateBulkResults lists the per entry outcome of the last bulk command
+	StateBulkResults = -104
+
+	stateAudit     = -105
+	stateJobs      = -106
+	stateJobOutput = -107
 )
 
 func RegisterBuiltins(reg *RegistryFacade, quit func(), showHelp func(), showAliases func()) {
@@ -31,6 +42,24 @@ func RegisterBuiltins(reg *RegistryFacade, quit func(), showHelp func(), showAli
 			LayoutKind:    domain.DisplayText,
 			Args:          map[string]interface{}{},
 		},
+		domain.State{
+			ID:            stateHistory,
+			ShortNameTmpl: "History",
+			LayoutKind:    domain.DisplayTable,
+			Args: map[string]interface{}{
+				"title":   "Command History",
+				"headers": []string{"#", "Command", "Count", "Last Used"},
+			},
+		},
+		domain.State{
+			ID:            StateBulkResults,
+			ShortNameTmpl: "Results",
+			LayoutKind:    domain.DisplayTable,
+			Args: map[string]interface{}{
+				"title":   "Results",
+				"headers": []string{"ID", "Status", "Output"},
+			},
+		},
 	)
 
 	reg.AddCommands(
@@ -79,7 +108,125 @@ func RegisterBuiltins(reg *RegistryFacade, quit func(), showHelp func(), showAli
 				return "Aliases listed", nil
 			},
 		},
+		&domain.Command{
+			Aliases:    []string{"history", "hist"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{stateHistory},
+			NoHistory:  true,
+			Handler: func(ctx *domain.Ctx, _ []string) (string, error) {
+				if ctx.History == nil {
+					return "No command history", nil
+				}
+				headers, rows := BuildHistoryTableModel(ctx.History.Ranked())
+				entries := historyEntries(rows)
+				ctx.State.SetNextState(stateHistory, func(a map[string]interface{}) {
+					a["headers"] = headers
+					a["entries"] = entries
+				})
+				return fmt.Sprintf("%d commands in history", len(rows)), nil
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"rerun", "!"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			NoHistory:  true,
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				if ctx.History == nil || ctx.Dispatch == nil {
+					return "", fmt.Errorf("history re-run is not available")
+				}
+				// Numbers refer to the table on screen, which is only known
+				// while the history view is open.
+				var shown []spec.Entry
+				if ctx.CurrentStateID == stateHistory {
+					shown, _ = ctx.StateArgs["entries"].([]spec.Entry)
+				}
+				line, err := historyLine(ctx.History.Ranked(), shown, args)
+				if err != nil {
+					return "", err
+				}
+				// History keeps redacted lines, running one would send the mask
+				if strings.Contains(line, secret.Mask) {
+					return "", fmt.Errorf("history entry %q has masked values, type it again", line)
+				}
+				return ctx.Dispatch(line)
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"back", ".."},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			NoHistory:  true,
+			Handler: func(ctx *domain.Ctx, _ []string) (string, error) {
+				if err := ctx.State.Pop(); err != nil {
+					return "", err
+				}
+				return "Back", nil
+			},
+		},
 	)
+
+	registerExecBuiltins(reg)
+	registerViewBuiltins(reg)
+	registerSelectionBuiltins(reg)
+	registerAuditBuiltins(reg)
+	registerJobBuiltins(reg)
+}
+
+// BuildHistoryTableModel lists history entries in the order given, numbered
+// from 1 so "rerun N" can refer to a row.
+func BuildHistoryTableModel(entries []domain.HistoryEntry) (headers []string, rows [][]string) {
+	headers = []string{"#", "Command", "Count", "Last Used"}
+	for i, e := range entries {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			e.Cmd,
+			strconv.Itoa(e.Count),
+			e.Last.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return
+}
+
+func historyEntries(rows [][]string) []spec.Entry {
+	var entries []spec.Entry
+	for _, row := range rows {
+		entries = append(entries, spec.Entry{
+			ID:     row[1], // the command line itself, unique after dedup
+			Values: row,
+		})
+	}
+	return entries
+}
+
+// historyLine picks a line by its number in the shown history table, or
+// the most relevant line starting with the given text. Numbers are looked up
+// in shown rather than re-ranked, since the ranking moves with every command.
+func historyLine(entries []domain.HistoryEntry, shown []spec.Entry, args []string) (string, error) {
+	if len(entries) == 0 {
+		return "", fmt.Errorf("command history is empty")
+	}
+	if len(args) == 0 {
+		return entries[0].Cmd, nil
+	}
+	if _, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if shown == nil {
+			return "", fmt.Errorf("open the history view to re-run by number")
+		}
+		for _, en := range shown {
+			if len(en.Values) > 1 && en.Values[0] == args[0] {
+				return en.Values[1], nil
+			}
+		}
+		return "", fmt.Errorf("no history entry %s", args[0])
+	}
+	prefix := strings.Join(args, " ")
+	for _, e := range entries {
+		if strings.HasPrefix(e.Cmd, prefix) {
+			return e.Cmd, nil
+		}
+	}
+	return "", fmt.Errorf("no history entry starting with %q", prefix)
 }
 
 // Helper to build a simple table model from commands
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ourorg/goui/pkg/audit"
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// AuditRows is how many of the newest audit records the audit state lists.
+const AuditRows = 1000
+
+// registerAuditBuiltins adds the audit log browser:
+//
+//	audit         list the newest records, newest first
+//	audit verify  check the hash chain of the log and its rotated files
+func registerAuditBuiltins(reg *RegistryFacade) {
+	reg.AddStates(domain.State{
+		ID:            stateAudit,
+		ShortNameTmpl: "Audit",
+		LayoutKind:    domain.DisplayTable,
+		Args: map[string]interface{}{
+			"title":   "Audit Log",
+			"headers": auditHeaders,
+		},
+	})
+	reg.AddCommands(&domain.Command{
+		Aliases:    []string{"audit"},
+		FromStates: []int{domain.StateAny},
+		ToStates:   []int{stateAudit},
+		NoHistory:  true,
+		Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+			if ctx.Audit == nil {
+				return "", fmt.Errorf("audit log is not enabled")
+			}
+			if len(args) > 0 && args[0] == "verify" {
+				n, err := ctx.Audit.Verify()
+				if err != nil {
+					return "", fmt.Errorf("audit log verification failed after %d records: %w", n, err)
+				}
+				return fmt.Sprintf("Audit log intact, %d records verified", n), nil
+			}
+			recs, err := ctx.Audit.Records(AuditRows)
+			if err != nil {
+				return "", err
+			}
+			headers, rows := BuildAuditTableModel(recs)
+			entries := make([]spec.Entry, 0, len(rows))
+			for _, row := range rows {
+				entries = append(entries, spec.Entry{ID: row[0], Values: row})
+			}
+			if err := ctx.State.SetNextState(stateAudit, func(a map[string]interface{}) {
+				a["headers"] = headers
+				a["entries"] = entries
+			}); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d audit records", len(rows)), nil
+		},
+	})
+}
+
+var auditHeaders = []string{"#", "Time", "User", "Mode", "Host", "Command", "Exit", "Duration", "State"}
+
+// BuildAuditTableModel lists records newest first, numbered by their
+// sequence in the log.
+func BuildAuditTableModel(recs []audit.Record) (headers []string, rows [][]string) {
+	headers = auditHeaders
+	for i := len(recs) - 1; i >= 0; i-- {
+		r := recs[i]
+		exit := strconv.Itoa(r.Exit)
+		if r.Error != "" && r.Exit == 0 {
+			exit = "error"
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(r.Seq, 10),
+			r.Time.Format("2006-01-02 15:04:05"),
+			r.User,
+			r.Mode,
+			r.Host,
+			r.Command,
+			exit,
+			(time.Duration(r.DurationMS) * time.Millisecond).String(),
+			r.State,
+		})
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/execx"
+)
+
+// registerExecBuiltins adds the exec command that switches where commands run:
+//
+//	exec                 show the current target
+//	exec local|demo      run locally or simulated
+//	exec ssh [user@]host run on a host, a profile name picks its options
+//	exec <profile>       run on a configured profile
+func registerExecBuiltins(reg *RegistryFacade) {
+	reg.AddCommands(&domain.Command{
+		Aliases:    []string{"exec"},
+		FromStates: []int{domain.StateAny},
+		ToStates:   []int{domain.StateSame},
+		Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+			if len(args) == 0 {
+				return "Running commands on " + describeExec(ctx.ExecConfig), nil
+			}
+			if ctx.SetExecMode == nil {
+				return "", fmt.Errorf("switching the executor is not available")
+			}
+			cfg, err := execTarget(ctx, args)
+			if err != nil {
+				return "", err
+			}
+			if err := ctx.SetExecMode(cfg.Mode, cfg); err != nil {
+				return "", err
+			}
+			return "Running commands on " + describeExec(cfg), nil
+		},
+	})
+}
+
+func execTarget(ctx *domain.Ctx, args []string) (execx.Config, error) {
+	cfg := ctx.ExecConfig
+	switch args[0] {
+	case "local":
+		cfg.Mode = execx.ModeLocal
+	case "demo":
+		cfg.Mode = execx.ModeDemo
+	case "ssh":
+		if len(args) < 2 {
+			if cfg.SSHHost == "" {
+				return cfg, fmt.Errorf("usage: exec ssh [user@]host")
+			}
+			cfg.Mode = execx.ModeSSH
+			break
+		}
+		if p, ok := ctx.ExecProfiles[args[1]]; ok && p.Mode == execx.ModeSSH {
+			return p, nil
+		}
+		cfg.Mode = execx.ModeSSH
+		cfg.SSHUser, cfg.SSHHost, cfg.SSHOptions = "", args[1], nil
+		if user, host, ok := strings.Cut(args[1], "@"); ok {
+			cfg.SSHUser, cfg.SSHHost = user, host
+		}
+	default:
+		p, ok := ctx.ExecProfiles[args[0]]
+		if !ok {
+			return cfg, fmt.Errorf("unknown exec target %q, use local, demo, ssh or a profile", args[0])
+		}
+		return p, nil
+	}
+	return cfg, nil
+}
+
+func describeExec(cfg execx.Config) string {
+	if cfg.Mode == execx.ModeSSH {
+		return "ssh " + cfg.Target()
+	}
+	return cfg.Target()
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// registerJobBuiltins adds the background job commands:
+//
+//	jobs            list jobs, newest first
+//	job open [N]    show the output of job N
+//	job wait [N]    block until job N is done
+//	job cancel [N]  stop job N
+//
+// N defaults to the selected row of the jobs table, then the newest job.
+func registerJobBuiltins(reg *RegistryFacade) {
+	reg.AddStates(
+		domain.State{
+			ID:            stateJobs,
+			ShortNameTmpl: "Jobs",
+			LayoutKind:    domain.DisplayTable,
+			Args: map[string]interface{}{
+				"title":   "Jobs",
+				"headers": jobHeaders,
+			},
+		},
+		domain.State{
+			ID:            stateJobOutput,
+			ShortNameTmpl: "Job {{.job}}",
+			LayoutKind:    domain.DisplayText,
+			Args:          map[string]interface{}{},
+		},
+	)
+	reg.AddCommands(
+		&domain.Command{
+			Aliases:    []string{"jobs"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{stateJobs},
+			NoHistory:  true,
+			Handler: func(ctx *domain.Ctx, _ []string) (string, error) {
+				if ctx.Jobs == nil {
+					return "", fmt.Errorf("background jobs are not available")
+				}
+				jobs := ctx.Jobs.Jobs()
+				headers, rows := BuildJobsTableModel(jobs)
+				entries := make([]spec.Entry, 0, len(rows))
+				for _, row := range rows {
+					entries = append(entries, spec.Entry{ID: row[0], Values: row})
+				}
+				if err := ctx.State.SetNextState(stateJobs, func(a map[string]interface{}) {
+					a["headers"] = headers
+					a["entries"] = entries
+				}); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d jobs", len(rows)), nil
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"job"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			NoHistory:  true,
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				if ctx.Jobs == nil {
+					return "", fmt.Errorf("background jobs are not available")
+				}
+				if len(args) == 0 {
+					return "", fmt.Errorf("usage: job open|wait|cancel [N]")
+				}
+				id, err := jobID(ctx, args[1:])
+				if err != nil {
+					return "", err
+				}
+				switch args[0] {
+				case "open", "o":
+					job, ok := ctx.Jobs.Job(id)
+					if !ok {
+						return "", fmt.Errorf("no job %d", id)
+					}
+					if err := openJob(ctx, job); err != nil {
+						return "", err
+					}
+					return fmt.Sprintf("Job %d %s", job.ID, job.Status), nil
+				case "wait", "w":
+					var job domain.Job
+					wait := func() { job, err = ctx.Jobs.Wait(id) }
+					if ctx.Blocking != nil {
+						ctx.Blocking(wait)
+					} else {
+						wait()
+					}
+					if err != nil {
+						return "", err
+					}
+					if err := openJob(ctx, job); err != nil {
+						return "", err
+					}
+					return jobSummary(job), nil
+				case "cancel", "kill", "c":
+					if err := ctx.Jobs.Cancel(id); err != nil {
+						return "", err
+					}
+					return fmt.Sprintf("Canceling job %d", id), nil
+				default:
+					return "", fmt.Errorf("unknown job action %q, use open, wait or cancel", args[0])
+				}
+			},
+		},
+	)
+}
+
+var jobHeaders = []string{"ID", "Status", "Command", "Started", "Duration", "Output"}
+
+// BuildJobsTableModel lists jobs in the order given with the last line of
+// their output so far.
+func BuildJobsTableModel(jobs []domain.Job) (headers []string, rows [][]string) {
+	headers = jobHeaders
+	for _, j := range jobs {
+		rows = append(rows, []string{
+			strconv.Itoa(j.ID),
+			j.Status.String(),
+			j.Command,
+			j.Started.Format("15:04:05"),
+			j.Duration().Round(time.Second).String(),
+			lastLine(j.Output),
+		})
+	}
+	return
+}
+
+// jobID is the job named in args, the selected one, or the newest.
+func jobID(ctx *domain.Ctx, args []string) (int, error) {
+	if len(args) > 0 {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid job id %q", args[0])
+		}
+		return id, nil
+	}
+	if ctx.CurrentStateID == stateJobs && len(ctx.Selection) == 1 {
+		if id, err := strconv.Atoi(ctx.Selection[0]); err == nil {
+			return id, nil
+		}
+	}
+	jobs := ctx.Jobs.Jobs()
+	if len(jobs) == 0 {
+		return 0, fmt.Errorf("no jobs")
+	}
+	return jobs[0].ID, nil
+}
+
+func openJob(ctx *domain.Ctx, job domain.Job) error {
+	text := job.Output
+	if text == "" {
+		text = "(no output yet)"
+	}
+	return ctx.State.Push(stateJobOutput, func(a map[string]interface{}) {
+		a["job"] = job.ID
+		a["text"] = text
+	})
+}
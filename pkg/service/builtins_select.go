@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/query"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// ArgSelection holds the selected entry IDs ([]string) of a state.
+const ArgSelection = "selection"
+
+// registerSelectionBuiltins adds commands that change the selection of the
+// current table or list. Lists use the item Main text as ID.
+func registerSelectionBuiltins(reg *RegistryFacade) {
+	sel := func(aliases []string, h func(ctx *domain.Ctx, args []string) (string, error)) *domain.Command {
+		return &domain.Command{
+			Aliases:    aliases,
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler:    h,
+		}
+	}
+	reg.AddCommands(
+		sel([]string{"select", "sel"}, func(ctx *domain.Ctx, args []string) (string, error) {
+			if err := checkIDs(ctx, args); err != nil {
+				return "", err
+			}
+			return setSelection(ctx, union(ctx.Selection, args))
+		}),
+		sel([]string{"unselect"}, func(ctx *domain.Ctx, args []string) (string, error) {
+			return setSelection(ctx, minus(ctx.Selection, args))
+		}),
+		sel([]string{"toggle"}, func(ctx *domain.Ctx, args []string) (string, error) {
+			if err := checkIDs(ctx, minus(args, ctx.Selection)); err != nil {
+				return "", err
+			}
+			next := ctx.Selection
+			for _, id := range args {
+				if contains(next, id) {
+					next = minus(next, []string{id})
+				} else {
+					next = union(next, []string{id})
+				}
+			}
+			return setSelection(ctx, next)
+		}),
+		sel([]string{"select-all"}, func(ctx *domain.Ctx, _ []string) (string, error) {
+			ids, err := entryIDs(ctx, nil)
+			if err != nil {
+				return "", err
+			}
+			return setSelection(ctx, union(ctx.Selection, ids))
+		}),
+		sel([]string{"select-none"}, func(ctx *domain.Ctx, _ []string) (string, error) {
+			return setSelection(ctx, nil)
+		}),
+		sel([]string{"invert"}, func(ctx *domain.Ctx, _ []string) (string, error) {
+			ids, err := entryIDs(ctx, nil)
+			if err != nil {
+				return "", err
+			}
+			return setSelection(ctx, minus(ids, ctx.Selection))
+		}),
+		sel([]string{"select-where"}, func(ctx *domain.Ctx, args []string) (string, error) {
+			if len(args) == 0 {
+				return "", fmt.Errorf("select-where needs a query, e.g. status:failed")
+			}
+			ids, err := entryIDs(ctx, args)
+			if err != nil {
+				return "", err
+			}
+			return setSelection(ctx, union(ctx.Selection, ids))
+		}),
+	)
+}
+
+func setSelection(ctx *domain.Ctx, ids []string) (string, error) {
+	return applyArgs(ctx, fmt.Sprintf("%d selected", len(ids)), func(a map[string]interface{}) {
+		if len(ids) == 0 {
+			delete(a, ArgSelection)
+			return
+		}
+		a[ArgSelection] = ids
+	})
+}
+
+// entryIDs lists the IDs of the rows the current view shows, across all
+// pages of a windowed source, optionally narrowed by a query.
+func entryIDs(ctx *domain.Ctx, queryArgs []string) ([]string, error) {
+	sp := ctx.Spec()
+	var ids []string
+	switch {
+	case sp.Table != nil:
+		t := sp.Table
+		entries := t.Entries
+		if t.Window != nil && t.Window.Total > len(entries) {
+			all, err := allSourceEntries(ctx, t)
+			if err != nil {
+				return nil, err
+			}
+			entries = all
+		}
+		var q *query.Query
+		if len(queryArgs) > 0 {
+			var err error
+			if q, err = query.Compile(strings.Join(queryArgs, " "), query.FromTable(t.Headers, t.ColSchema)); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range entries {
+			if q == nil || q.Match(e.Values) {
+				ids = append(ids, e.ID)
+			}
+		}
+	case sp.List != nil:
+		q := strings.Join(queryArgs, " ")
+		for _, it := range filterList(sp.List.Items, q) {
+			ids = append(ids, it.Main)
+		}
+	default:
+		return nil, fmt.Errorf("nothing to select in this view")
+	}
+	return ids, nil
+}
+
+// allSourceEntries re-reads the current state's source without paging,
+// filtered and sorted the way the table shows it.
+func allSourceEntries(ctx *domain.Ctx, t *spec.Table) ([]spec.Entry, error) {
+	src, _ := ctx.StateArgs[ArgSource].(spec.Source[spec.Entry])
+	if src == nil {
+		return nil, fmt.Errorf("no source for this view")
+	}
+	args := copyArgs(ctx.StateArgs)
+	args[ArgOffset], args[ArgPageSize] = 0, src.Len()
+	entries, _, _, err := windowEntries(src, t.Headers, t.ColSchema, args)
+	return entries, err
+}
+
+// checkIDs reports the IDs the current view has no row for, so a typo is
+// not silently kept in the selection.
+func checkIDs(ctx *domain.Ctx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	known, err := entryIDs(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if unknown := minus(ids, known); len(unknown) > 0 {
+		return fmt.Errorf("no such entry: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func contains(list []string, id string) bool {
+	for _, s := range list {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+// union appends the IDs not yet in list, keeping the selection order.
+func union(list, ids []string) []string {
+	out := append([]string(nil), list...)
+	for _, id := range ids {
+		if !contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func minus(list, ids []string) []string {
+	var out []string
+	for _, id := range list {
+		if !contains(ids, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// registerViewBuiltins adds commands that configure the spec pipeline
+// stages of the current state through its args.
+func registerViewBuiltins(reg *RegistryFacade) {
+	reg.AddCommands(
+		&domain.Command{
+			Aliases:    []string{"filter", "f"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				term := strings.Join(args, " ")
+				msg := "Filter: " + term
+				if term == "" {
+					msg = "Filter cleared"
+				}
+				return applyArgs(ctx, msg, func(a map[string]interface{}) {
+					a[ArgSearchTerm] = term
+					a["searchActive"] = term != ""
+					delete(a, ArgOffset) // back to the first page of the new result
+				})
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"sort"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				if len(args) == 0 || args[0] == "off" {
+					return applyArgs(ctx, "Sorting cleared", func(a map[string]interface{}) {
+						delete(a, ArgSort)
+					})
+				}
+				line := strings.Join(args, " ")
+				if _, err := ParseSort(line); err != nil {
+					return "", err
+				}
+				return applyArgs(ctx, "Sorted by "+line, func(a map[string]interface{}) {
+					a[ArgSort] = line
+				})
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"columns", "cols"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				cols := stringList(strings.Join(args, ","))
+				if len(cols) == 0 || (len(cols) == 1 && cols[0] == "all") {
+					return applyArgs(ctx, "Showing all columns", func(a map[string]interface{}) {
+						delete(a, ArgColumns)
+					})
+				}
+				return applyArgs(ctx, "Columns: "+strings.Join(cols, ", "), func(a map[string]interface{}) {
+					a[ArgColumns] = cols
+				})
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"col", "column"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler:    columnCommand,
+		},
+		&domain.Command{
+			Aliases:    []string{"group"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				if len(args) == 0 || args[0] == "off" {
+					return applyArgs(ctx, "Grouping cleared", func(a map[string]interface{}) {
+						delete(a, ArgGroupBy)
+					})
+				}
+				col := strings.Join(args, " ")
+				return applyArgs(ctx, "Grouped by "+col, func(a map[string]interface{}) {
+					a[ArgGroupBy] = col
+				})
+			},
+		},
+		&domain.Command{
+			Aliases:    []string{"page"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler:    pageCommand,
+		},
+		&domain.Command{
+			Aliases:    []string{"limit"},
+			FromStates: []int{domain.StateAny},
+			ToStates:   []int{domain.StateSame},
+			Handler: func(ctx *domain.Ctx, args []string) (string, error) {
+				if len(args) == 0 || args[0] == "off" {
+					return applyArgs(ctx, "Limit cleared", func(a map[string]interface{}) {
+						delete(a, ArgLimit)
+					})
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return "", fmt.Errorf("limit needs a positive number, got %q", args[0])
+				}
+				return applyArgs(ctx, fmt.Sprintf("Showing at most %d", n), func(a map[string]interface{}) {
+					a[ArgLimit] = n
+				})
+			},
+		},
+	)
+}
+
+// applyArgs updates the current state's args and returns msg on success.
+func applyArgs(ctx *domain.Ctx, msg string, mutate func(map[string]interface{})) (string, error) {
+	if err := ctx.State.UpdateArgs(mutate); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
+
+// columnCommand implements "col hide|show|move|width" on the current table.
+func columnCommand(ctx *domain.Ctx, args []string) (string, error) {
+	usage := fmt.Errorf("usage: col hide NAME | show NAME|all | move NAME POS | width NAME N|auto")
+	if len(args) < 2 {
+		return "", usage
+	}
+	if ctx.Spec().Table == nil {
+		return "", fmt.Errorf("not a table")
+	}
+	sub, name := args[0], args[1]
+	// Names resolve against all of the state's columns, not the ones the
+	// current projection shows, so hidden or dropped columns can be named.
+	headers := stateHeaders(ctx.StateArgs)
+	if !(sub == "show" && name == "all") {
+		i, err := columnIndex(headers, name)
+		if err != nil {
+			return "", err
+		}
+		name = headers[i]
+	}
+	switch sub {
+	case "hide":
+		return applyArgs(ctx, "Hidden column "+name, func(a map[string]interface{}) {
+			a[ArgHidden] = appendUnique(removeFold(stringList(a[ArgHidden]), name), name)
+		})
+	case "show":
+		if name == "all" {
+			return applyArgs(ctx, "Showing all columns", func(a map[string]interface{}) {
+				delete(a, ArgHidden)
+				delete(a, ArgColumns)
+			})
+		}
+		return applyArgs(ctx, "Showing column "+name, func(a map[string]interface{}) {
+			a[ArgHidden] = removeFold(stringList(a[ArgHidden]), name)
+			if cols := stringList(a[ArgColumns]); len(cols) > 0 {
+				a[ArgColumns] = appendUnique(cols, name)
+			}
+		})
+	case "move":
+		if len(args) < 3 {
+			return "", usage
+		}
+		pos, err := strconv.Atoi(args[2])
+		if err != nil || pos < 1 {
+			return "", fmt.Errorf("column position must be 1 or more, got %q", args[2])
+		}
+		order := stringList(ctx.StateArgs[ArgColumns])
+		if len(order) == 0 {
+			order = headers
+		}
+		order = removeFold(order, name)
+		if pos > len(order)+1 {
+			pos = len(order) + 1
+		}
+		order = append(order[:pos-1], append([]string{name}, order[pos-1:]...)...)
+		return applyArgs(ctx, fmt.Sprintf("Moved column %s to %d", name, pos), func(a map[string]interface{}) {
+			a[ArgColumns] = order
+		})
+	case "width":
+		if len(args) < 3 {
+			return "", usage
+		}
+		w := 0
+		if args[2] != "auto" {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("column width must be a positive number or auto, got %q", args[2])
+			}
+			w = n
+		}
+		return applyArgs(ctx, fmt.Sprintf("Column %s width %s", name, args[2]), func(a map[string]interface{}) {
+			widths := map[string]int{}
+			if old, ok := a[ArgWidths].(map[string]int); ok {
+				for k, v := range old {
+					widths[k] = v
+				}
+			}
+			if w == 0 {
+				delete(widths, name)
+			} else {
+				widths[name] = w
+			}
+			a[ArgWidths] = widths
+		})
+	}
+	return "", usage
+}
+
+// stateHeaders returns the table headers of a state before the pipeline
+// projects them, defaulting like BuildSpec does.
+func stateHeaders(args map[string]interface{}) []string {
+	if h, ok := args["headers"].([]string); ok && len(h) > 0 {
+		return h
+	}
+	return []string{"Name"}
+}
+
+func removeFold(list []string, name string) []string {
+	var out []string
+	for _, s := range list {
+		if !strings.EqualFold(s, name) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, name string) []string {
+	for _, s := range list {
+		if strings.EqualFold(s, name) {
+			return list
+		}
+	}
+	return append(list, name)
+}
+
+// pageCommand moves the window of a source backed state: next, prev,
+// first, last or a 1-based page number.
+func pageCommand(ctx *domain.Ctx, args []string) (string, error) {
+	sp := ctx.Spec()
+	w := windowOf(sp)
+	if w == nil {
+		return "", fmt.Errorf("this view is not paged")
+	}
+	if len(args) == 0 {
+		return pageInfo(w.Offset, w), nil
+	}
+	offset := w.Offset
+	switch args[0] {
+	case "next", "n":
+		offset += w.Size
+	case "prev", "p":
+		offset -= w.Size
+	case "first":
+		offset = 0
+	case "last":
+		offset = w.Total - w.Size
+	default:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("page needs next, prev, first, last or a page number, got %q", args[0])
+		}
+		offset = (n - 1) * w.Size
+	}
+	offset = ClampOffset(offset, w)
+	return applyArgs(ctx, pageInfo(offset, w), func(a map[string]interface{}) {
+		a[ArgOffset] = offset
+	})
+}
+
+// ClampOffset keeps an offset within the window's source, last page full.
+func ClampOffset(offset int, w *spec.Window) int {
+	if offset > w.Total-w.Size {
+		offset = w.Total - w.Size
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return offset
+}
+
+func pageInfo(offset int, w *spec.Window) string {
+	if w.Total == 0 {
+		return "No rows"
+	}
+	end := offset + w.Size
+	if end > w.Total {
+		end = w.Total
+	}
+	return fmt.Sprintf("Rows %d-%d of %d", offset+1, end, w.Total)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// maxBulkWorkers bounds how many targets a Parallel bulk command runs at once.
+const maxBulkWorkers = 8
+
+// BulkResult is the outcome of a bulk command for one target.
+type BulkResult struct {
+	ID     string
+	Output string
+	Err    error
+	// Runs it took when the command retries, see domain.Command.Retry
+	Attempts int
+}
+
+// runBulk runs cmd once per selected ID and shows the results table.
+// Commands without a handler run their CmdTmpl through the executor.
+func runBulk(cmd *domain.Command, ctx *domain.Ctx, args []string) (string, error) {
+	if len(ctx.Selection) == 0 {
+		return "", fmt.Errorf("no entries selected")
+	}
+	var mu sync.Mutex
+	finished := 0
+	run := func(id string) BulkResult {
+		c := *ctx
+		c.Target = id
+		c.Progress = ctx.Progress.Task(id)
+		defer func() {
+			c.Progress.Done()
+			mu.Lock()
+			finished++
+			ctx.Progress.Set(float64(finished)*100/float64(len(ctx.Selection)), fmt.Sprintf("%d/%d done", finished, len(ctx.Selection)))
+			mu.Unlock()
+		}()
+		if cmd.Handler != nil {
+			out, err := cmd.Handler(&c, args)
+			return BulkResult{ID: id, Output: out, Err: err}
+		}
+		if c.Exec == nil {
+			return BulkResult{ID: id, Output: "Executing mock: " + cmd.CmdTmpl}
+		}
+		res, err := c.Exec.RunTemplate(cmd.CmdTmpl, c.TemplateData(args))
+		out := res.Stdout
+		if err == nil && res.ExitCode != 0 {
+			err = fmt.Errorf("exit %d: %s", res.ExitCode, res.Stderr)
+		}
+		return BulkResult{ID: id, Output: out, Err: err, Attempts: res.Attempts}
+	}
+
+	results := make([]BulkResult, len(ctx.Selection))
+	if cmd.Parallel {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxBulkWorkers)
+		for i, id := range ctx.Selection {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, id string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = run(id)
+			}(i, id)
+		}
+		wg.Wait()
+	} else {
+		for i, id := range ctx.Selection {
+			results[i] = run(id)
+		}
+	}
+
+	failed := 0
+	entries := make([]spec.Entry, 0, len(results))
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "failed: " + r.Err.Error()
+			failed++
+		}
+		if r.Attempts > 1 {
+			status += fmt.Sprintf(" (%d attempts)", r.Attempts)
+		}
+		entries = append(entries, spec.Entry{ID: r.ID, Values: []string{r.ID, status, firstLine(r.Output)}})
+	}
+	title := "Results"
+	if len(cmd.Aliases) > 0 {
+		title += ": " + cmd.Aliases[0]
+	}
+	if err := ctx.State.SetNextState(StateBulkResults, func(a map[string]interface{}) {
+		a["title"] = title
+		a["entries"] = entries
+	}); err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("Ran on %d entries, %d failed", len(results), failed)
+	if failed > 0 {
+		return msg, fmt.Errorf("%d of %d targets failed", failed, len(results))
+	}
+	return msg, nil
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " …"
+	}
+	return s
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return "… " + s[i+1:]
+	}
+	return s
+}
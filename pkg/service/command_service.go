@@ -1,48 +1,22 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/fuzzy"
+	"github.com/ourorg/goui/pkg/secret"
 )
 
-type CmdHistoryEntry struct {
-	Cmd   string
-	Count int
-	Last  time.Time
-}
-
-type CmdHistory struct {
-	entries map[string]*CmdHistoryEntry
-	mu      sync.Mutex
-}
-
-func newCmdHistory() *CmdHistory {
-	return &CmdHistory{entries: map[string]*CmdHistoryEntry{}}
-}
-
-func (h *CmdHistory) Touch(cmd string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	e := h.entries[cmd]
-	if e == nil {
-		e = &CmdHistoryEntry{Cmd: cmd}
-		h.entries[cmd] = e
-	}
-	e.Count++
-	e.Last = time.Now()
-}
-
-func (h *CmdHistory) Entries() map[string]*CmdHistoryEntry {
-	return h.entries
-}
-
 type CommandService struct {
 	cmdReg *CommandRegistry
 	hist   *CmdHistory
+	jobs   *JobManager
 	// Engine wiring
 	ctxBuilder func() *domain.Ctx
 }
@@ -51,10 +25,19 @@ func NewCommandService(reg *CommandRegistry, ctxBuilder func() *domain.Ctx) *Com
 	return &CommandService{
 		cmdReg:     reg,
 		hist:       newCmdHistory(),
+		jobs:       NewJobManager(),
 		ctxBuilder: ctxBuilder,
 	}
 }
 
+func (s *CommandService) History() *CmdHistory {
+	return s.hist
+}
+
+func (s *CommandService) Jobs() *JobManager {
+	return s.jobs
+}
+
 func (s *CommandService) TouchHistory(cmd string) {
 	s.hist.Touch(cmd)
 }
@@ -67,36 +50,28 @@ func (s *CommandService) Suggestions(prefix string) []string {
 	seen := map[string]bool{}
 	var out []string
 
-	// history first
-	type row struct {
-		cmd  string
-		last time.Time
+	// history first, best fuzzy matches on top, frecency breaking ties
+	var lines []string
+	for _, e := range s.hist.Ranked() {
+		lines = append(lines, e.Cmd)
 	}
-	var hs []row
-	for _, e := range s.hist.Entries() {
-		if strings.HasPrefix(e.Cmd, prefix) {
-			hs = append(hs, row{e.Cmd, e.Last})
-		}
-	}
-	sort.Slice(hs, func(i, j int) bool {
-		return hs[i].last.After(hs[j].last)
-	})
-	for _, r := range hs {
-		out = append(out, r.cmd)
-		seen[r.cmd] = true
+	for _, m := range fuzzy.Rank(prefix, lines) {
+		out = append(out, m.Text)
+		seen[m.Text] = true
 	}
 
-	// then all aliases
-	var rest []string
-	for _, c := range s.cmdReg.Index() {
-		for _, a := range c.Aliases {
-			if strings.HasPrefix(a, prefix) && !seen[a] {
-				rest = append(rest, a)
-			}
+	// then all aliases, alphabetical among equal scores
+	var aliases []string
+	for a := range s.cmdReg.Index() {
+		if !seen[a] {
+			aliases = append(aliases, a)
 		}
 	}
-	sort.Strings(rest)
-	return append(out, rest...)
+	sort.Strings(aliases)
+	for _, m := range fuzzy.Rank(prefix, aliases) {
+		out = append(out, m.Text)
+	}
+	return out
 }
 
 func (s *CommandService) Autocomplete(prefix string) []string {
@@ -111,27 +86,117 @@ func (s *CommandService) Autocomplete(prefix string) []string {
 	return res
 }
 
+// Resolve finds a command by exact alias, falling back to an unambiguous
+// abbreviation: a prefix of exactly one command's aliases. Fuzzy matches
+// are only offered as suggestions, never run.
 func (s *CommandService) Resolve(alias string) (*domain.Command, bool) {
-	for _, c := range s.cmdReg.Index() {
-		for _, a := range c.Aliases {
-			if a == alias {
-				return c, true
-			}
+	c, _, ok := s.resolve(alias)
+	return c, ok
+}
+
+// resolve is Resolve that also returns the full alias the input stands for.
+func (s *CommandService) resolve(alias string) (*domain.Command, string, bool) {
+	if alias == "" {
+		return nil, "", false
+	}
+	idx := s.cmdReg.Index()
+	if c, ok := idx[alias]; ok {
+		return c, alias, true
+	}
+	var found *domain.Command
+	var full string
+	for a, c := range idx {
+		if !strings.HasPrefix(a, alias) {
+			continue
+		}
+		if found != nil && found != c {
+			return nil, "", false
+		}
+		// Of several aliases of the same command, name it by the shortest
+		if found == nil || len(a) < len(full) || (len(a) == len(full) && a < full) {
+			full = a
 		}
+		found = c
 	}
-	return nil, false
+	return found, full, found != nil
 }
 
 func (s *CommandService) Dispatch(alias string, args []string) (string, error) {
-	cmd, ok := s.Resolve(alias)
+	cmd, full, ok := s.resolve(alias)
 	if !ok {
 		return "Unknown command: " + alias, nil
 	}
-	s.TouchHistory(alias)
+	// An abbreviation runs, and is remembered, as the alias it stands for
+	alias = full
 
 	ctx := s.ctxBuilder()
+	line := secret.Redact(cmd.Line(alias, args))
+	// dry runs record at once, for the preview of the command that started them
+	if cmd.Background && (ctx.Exec == nil || ctx.Exec.Mode() != execx.ModeDryRun) {
+		job := s.jobs.Start(line, func(jctx context.Context, out *JobOutput) (string, error) {
+			// history is written after the run, once secrets it resolved are known
+			defer s.record(cmd, alias, args)
+			ctx.Context = jctx
+			ctx.Progress = ctx.Progress.For(line, out.JobID())
+			if ctx.Exec != nil {
+				ctx.Exec = execx.Chain(execx.WithOptions(ctx.Exec, execx.Options{Context: jctx}), out.Capture())
+			}
+			return s.run(cmd, ctx, alias, args)
+		})
+		return fmt.Sprintf("Started job %d: %s", job.ID, job.Command), nil
+	}
+	defer s.record(cmd, alias, args)
+	ctx.Progress = ctx.Progress.For(line, 0)
+	return s.run(cmd, ctx, alias, args)
+}
+
+// run runs the handler, or the bulk targets, and ends any progress it
+// reported.
+func (s *CommandService) run(cmd *domain.Command, ctx *domain.Ctx, alias string, args []string) (string, error) {
+	defer ctx.Progress.Done()
+	if ctx.Exec != nil {
+		opts := cmd.ExecOptions
+		if cmd.Sensitive {
+			opts.Label = alias
+		}
+		ctx.Exec = execx.WithOptions(ctx.Exec, opts)
+		if cmd.Retry != nil {
+			ctx.Exec = execx.Chain(ctx.Exec, execx.Retry(retryWithInfo(*cmd.Retry, alias, cmd.SetInfo)))
+		}
+	}
+	if cmd.Bulk {
+		return runBulk(cmd, ctx, args)
+	}
 	if cmd.Handler == nil {
 		return "Executing mock: " + cmd.CmdTmpl, nil
 	}
 	return cmd.Handler(ctx, args)
-}
\ No newline at end of file
+}
+
+// record adds the command line to history with secrets masked, sensitive
+// commands by alias only.
+func (s *CommandService) record(cmd *domain.Command, alias string, args []string) {
+	if !cmd.NoHistory {
+		s.TouchHistory(secret.Redact(cmd.Line(alias, args)))
+	}
+}
+
+// retryWithInfo reports each retry to the info line, after the policy's
+// own OnRetry.
+func retryWithInfo(p execx.RetryPolicy, alias string, info func(string)) execx.RetryPolicy {
+	if info == nil {
+		return p
+	}
+	onRetry := p.OnRetry
+	p.OnRetry = func(attempt int, delay time.Duration, res execx.Result, err error) {
+		if onRetry != nil {
+			onRetry(attempt, delay, res, err)
+		}
+		reason := fmt.Sprintf("exit %d", res.ExitCode)
+		if res.TimedOut {
+			reason = "timed out"
+		}
+		info(fmt.Sprintf("%s %s, retrying in %s (attempt %d/%d)", alias, reason, delay.Round(time.Millisecond), attempt, p.MaxAttempts))
+	}
+	return p
+}
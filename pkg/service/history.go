@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/util"
+)
+
+// CmdHistoryEntry is kept as the service name for domain.HistoryEntry
+type CmdHistoryEntry = domain.HistoryEntry
+
+// DefaultHistoryMax caps the number of distinct command lines kept
+const DefaultHistoryMax = 1000
+
+const historyLockTimeout = 2 * time.Second
+
+// CmdHistory tracks full command lines, deduplicated, ranked by frecency.
+// Once opened on a file every use is appended to it under a file lock so
+// concurrent instances share one history.
+type CmdHistory struct {
+	entries map[string]*CmdHistoryEntry
+	mu      sync.Mutex
+
+	path    string
+	max     int
+	appends int // records appended since the last compaction
+}
+
+func newCmdHistory() *CmdHistory {
+	return &CmdHistory{entries: map[string]*CmdHistoryEntry{}, max: DefaultHistoryMax}
+}
+
+// Open loads the history file and persists further touches to it.
+// max <= 0 uses DefaultHistoryMax.
+func (h *CmdHistory) Open(path string, max int) error {
+	if max <= 0 { max = DefaultHistoryMax }
+	unlock, err := util.LockFile(path, historyLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Files written by older versions were world-readable
+	if err := os.Chmod(path, 0600); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.Warnf("Failed to restrict permissions on %s: %v", path, err)
+	}
+	loaded, err := readHistoryFile(path)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.path = path
+	h.max = max
+	for _, in := range loaded {
+		h.merge(in)
+	}
+	h.trim()
+	return nil
+}
+
+func (h *CmdHistory) Touch(cmd string) {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" { return }
+	h.mu.Lock()
+	e := h.entries[cmd]
+	if e == nil {
+		e = &CmdHistoryEntry{Cmd: cmd}
+		h.entries[cmd] = e
+	}
+	e.Count++
+	e.Last = time.Now()
+	h.trim()
+
+	// The file is written after unlocking, so a slow disk or a contended
+	// lock file never blocks readers of the in-memory history.
+	path, max, rec := h.path, h.max, CmdHistoryEntry{Cmd: cmd, Count: 1, Last: e.Last}
+	compact := false
+	if path != "" {
+		h.appends++
+		if h.appends >= max {
+			compact, h.appends = true, 0
+		}
+	}
+	h.mu.Unlock()
+
+	if path != "" {
+		if err := persistHistory(path, max, rec, compact); err != nil {
+			logrus.Warnf("Failed to persist command history: %v", err)
+		}
+	}
+}
+
+// Entries returns copies of all entries by command line.
+func (h *CmdHistory) Entries() map[string]*CmdHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]*CmdHistoryEntry, len(h.entries))
+	for k, e := range h.entries {
+		cp := *e
+		out[k] = &cp
+	}
+	return out
+}
+
+// Snapshot returns copies of all entries, used for session persistence.
+func (h *CmdHistory) Snapshot() []CmdHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]CmdHistoryEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Cmd < out[j].Cmd })
+	return out
+}
+
+// Restore merges saved entries, keeping the higher count and latest use.
+func (h *CmdHistory) Restore(entries []CmdHistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, in := range entries {
+		e := h.entries[in.Cmd]
+		if e == nil {
+			cp := in
+			h.entries[in.Cmd] = &cp
+			continue
+		}
+		if in.Count > e.Count { e.Count = in.Count }
+		if in.Last.After(e.Last) { e.Last = in.Last }
+	}
+	h.trim()
+}
+
+// Ranked returns all entries by frecency, most relevant first.
+func (h *CmdHistory) Ranked() []CmdHistoryEntry {
+	out := h.Snapshot()
+	rankByFrecency(out, time.Now())
+	return out
+}
+
+// ReverseSearch works like Ctrl-R in a shell: it returns the skip-th most
+// recent command line containing query, so repeated presses walk further back.
+func (h *CmdHistory) ReverseSearch(query string, skip int) (CmdHistoryEntry, bool) {
+	var hits []CmdHistoryEntry
+	for _, e := range h.Snapshot() {
+		if strings.Contains(e.Cmd, query) {
+			hits = append(hits, e)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Last.After(hits[j].Last) })
+	if skip < 0 || skip >= len(hits) {
+		return CmdHistoryEntry{}, false
+	}
+	return hits[skip], true
+}
+
+// Frecency combines how often and how recently a command line was used,
+// bucketed the same way browsers rank their address bar history.
+func Frecency(e CmdHistoryEntry, now time.Time) float64 {
+	age := now.Sub(e.Last)
+	weight := 0.25
+	switch {
+	case age < time.Hour:
+		weight = 4
+	case age < 24*time.Hour:
+		weight = 2
+	case age < 7*24*time.Hour:
+		weight = 1
+	case age < 30*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(e.Count) * weight
+}
+
+func rankByFrecency(es []CmdHistoryEntry, now time.Time) {
+	sort.SliceStable(es, func(i, j int) bool {
+		fi, fj := Frecency(es[i], now), Frecency(es[j], now)
+		if fi != fj { return fi > fj }
+		return es[i].Last.After(es[j].Last)
+	})
+}
+
+func (h *CmdHistory) merge(in CmdHistoryEntry) {
+	e := h.entries[in.Cmd]
+	if e == nil {
+		e = &CmdHistoryEntry{Cmd: in.Cmd}
+		h.entries[in.Cmd] = e
+	}
+	e.Count += in.Count
+	if in.Last.After(e.Last) { e.Last = in.Last }
+}
+
+// trim drops the least relevant entries above the cap. Caller holds mu.
+func (h *CmdHistory) trim() {
+	if h.max <= 0 || len(h.entries) <= h.max { return }
+	all := make([]CmdHistoryEntry, 0, len(h.entries))
+	for _, e := range h.entries {
+		all = append(all, *e)
+	}
+	rankByFrecency(all, time.Now())
+	for _, e := range all[h.max:] {
+		delete(h.entries, e.Cmd)
+	}
+}
+
+// persistHistory appends one record to path, or rewrites the file keeping
+// at most max entries when compact is set. Callers must not hold a
+// CmdHistory's mu.
+func persistHistory(path string, max int, rec CmdHistoryEntry, compact bool) error {
+	unlock, err := util.LockFile(path, historyLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if compact {
+		// Pick up what other instances wrote before rewriting the file
+		loaded, err := readHistoryFile(path)
+		if err != nil {
+			return err
+		}
+		merged := newCmdHistory()
+		merged.max = max
+		for _, in := range loaded {
+			merged.merge(in)
+		}
+		merged.merge(rec)
+		merged.trim()
+		return writeHistoryFile(path, merged.Snapshot())
+	}
+
+	// Commands can carry hostnames and arguments, keep the file private.
+	// LockFile has already created the directory.
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(rec)
+}
+
+func readHistoryFile(path string) ([]CmdHistoryEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []CmdHistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e CmdHistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Cmd == "" {
+			// A torn write from a crashed instance only loses that line
+			logrus.Debugf("Skipping bad history line in %s: %v", path, err)
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+func writeHistoryFile(path string, es []CmdHistoryEntry) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range es {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
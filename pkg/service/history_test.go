@@ -0,0 +1,72 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/secret"
+)
+
+func TestRerunUsesShownRow(t *testing.T) {
+	h := newCmdHistory()
+	h.Touch("pods")
+	h.Touch("ns")
+	h.Touch("ns")
+	_, rows := BuildHistoryTableModel(h.Ranked())
+	shown := historyEntries(rows)
+	want := rows[1][1]
+
+	// ranking changes after the table was shown
+	for i := 0; i < 5; i++ {
+		h.Touch(want + "x")
+	}
+	got, err := historyLine(h.Ranked(), shown, []string{"2"})
+	if err != nil || got != want {
+		t.Errorf("rerun 2 = %q, %v, want %q", got, err, want)
+	}
+	if _, err := historyLine(h.Ranked(), nil, []string{"2"}); err == nil {
+		t.Error("rerun by number without a shown table should fail")
+	}
+	if _, err := historyLine(h.Ranked(), shown, []string{"9"}); err == nil {
+		t.Error("rerun of a row that is not shown should fail")
+	}
+}
+
+func TestRerunRefusesMaskedLine(t *testing.T) {
+	reg := NewRegistry()
+	RegisterBuiltins(reg, nil, nil, nil)
+	h := newCmdHistory()
+	h.Touch("login --token " + secret.Mask)
+	var dispatched []string
+	ctx := &domain.Ctx{
+		History:  h,
+		Dispatch: func(line string) (string, error) { dispatched = append(dispatched, line); return "", nil },
+	}
+	cmd := reg.CommandRegistry().Index()["rerun"]
+	if _, err := cmd.Handler(ctx, nil); err == nil || !strings.Contains(err.Error(), "masked") {
+		t.Errorf("rerun of a masked line: err = %v", err)
+	}
+	if len(dispatched) != 0 {
+		t.Errorf("dispatched %q", dispatched)
+	}
+}
+
+func TestHistoryTouchPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h := newCmdHistory()
+	if err := h.Open(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a", "b", "a", "c", "d", "a"} {
+		h.Touch(line)
+	}
+	again := newCmdHistory()
+	if err := again.Open(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := again.Entries()["a"]; got == nil || got.Count != 3 {
+		t.Errorf("reloaded entry a = %+v, want count 3", got)
+	}
+}
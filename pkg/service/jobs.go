@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/execx"
+)
+
+// Limits of the job manager: finished jobs kept, and output bytes kept per
+// job, the rest is dropped with a note.
+const (
+	DefaultJobsMax = 100
+	maxJobOutput   = 1 << 20
+)
+
+// JobManager runs commands in the background and keeps their outcome.
+type JobManager struct {
+	mu     sync.Mutex
+	seq    int
+	jobs   []*job // oldest first
+	notify func(string)
+}
+
+type job struct {
+	domain.Job
+	out    strings.Builder
+	cut    bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewJobManager() *JobManager {
+	return &JobManager{}
+}
+
+// SetNotify sets where completion messages go. It is called from the job's
+// goroutine.
+func (m *JobManager) SetNotify(fn func(string)) {
+	m.mu.Lock()
+	m.notify = fn
+	m.mu.Unlock()
+}
+
+// Start runs fn on its own goroutine as a new job. The context is canceled
+// by Cancel, and everything written to the writer becomes the job's output
+// ahead of the message fn returns. It returns the job as started.
+func (m *JobManager) Start(command string, fn func(ctx context.Context, out *JobOutput) (string, error)) domain.Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.seq++
+	j := &job{
+		Job:    domain.Job{ID: m.seq, Command: command, Started: time.Now(), Status: domain.JobRunning},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.jobs = append(m.jobs, j)
+	m.prune()
+	snap := j.Job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		// A panicking job fails instead of taking the app down, and its
+		// waiters still return.
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.Errorf("Job %d (%s) panicked: %v\n%s", j.ID, j.Command, r, debug.Stack())
+				m.finish(j, context.Background(), "", fmt.Errorf("panic: %v", r))
+			}
+		}()
+		msg, err := fn(ctx, &JobOutput{m: m, j: j})
+		m.finish(j, ctx, msg, err)
+	}()
+	return snap
+}
+
+func (m *JobManager) finish(j *job, ctx context.Context, msg string, err error) {
+	m.mu.Lock()
+	if msg != "" {
+		m.write(j, msg)
+	}
+	j.Finished = time.Now()
+	j.Err = err
+	switch {
+	case ctx.Err() != nil:
+		j.Status = domain.JobCanceled
+	case err != nil:
+		j.Status = domain.JobFailed
+	default:
+		j.Status = domain.JobDone
+	}
+	snap := m.snapshot(j)
+	notify := m.notify
+	close(j.done)
+	m.mu.Unlock()
+
+	if notify != nil {
+		notify(jobSummary(snap))
+	}
+}
+
+// jobSummary is the completion message, e.g. "Job 3 (deploy web) done in 2s".
+func jobSummary(j domain.Job) string {
+	s := fmt.Sprintf("Job %d (%s) %s in %s", j.ID, j.Command, j.Status, j.Duration().Round(time.Millisecond))
+	if j.Status == domain.JobFailed && j.Err != nil {
+		s += ": " + j.Err.Error()
+	}
+	return s
+}
+
+// write appends to the job's output, under m.mu.
+func (m *JobManager) write(j *job, s string) {
+	if j.cut {
+		return
+	}
+	if j.out.Len() > 0 && !strings.HasSuffix(j.out.String(), "\n") {
+		j.out.WriteByte('\n')
+	}
+	room := maxJobOutput - j.out.Len()
+	if room < 0 {
+		room = 0 // the separator went past the limit
+	}
+	if len(s) > room {
+		for room > 0 && !utf8.RuneStart(s[room]) {
+			room--
+		}
+		j.out.WriteString(s[:room])
+		j.out.WriteString("\n[output truncated]")
+		j.cut = true
+		return
+	}
+	j.out.WriteString(s)
+}
+
+// prune drops the oldest finished jobs beyond DefaultJobsMax, under m.mu.
+func (m *JobManager) prune() {
+	extra := len(m.jobs) - DefaultJobsMax
+	if extra <= 0 {
+		return
+	}
+	kept := m.jobs[:0]
+	for _, j := range m.jobs {
+		if extra > 0 && j.Status != domain.JobRunning {
+			extra--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	m.jobs = kept
+}
+
+// Jobs returns snapshots of all jobs, newest first.
+func (m *JobManager) Jobs() []domain.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]domain.Job, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		out = append(out, m.snapshot(m.jobs[i]))
+	}
+	return out
+}
+
+func (m *JobManager) Job(id int) (domain.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j := m.find(id); j != nil {
+		return m.snapshot(j), true
+	}
+	return domain.Job{}, false
+}
+
+// Cancel stops a running job, its status turns canceled once it returns.
+func (m *JobManager) Cancel(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.find(id)
+	if j == nil {
+		return fmt.Errorf("no job %d", id)
+	}
+	if j.Status != domain.JobRunning {
+		return fmt.Errorf("job %d already %s", id, j.Status)
+	}
+	j.cancel()
+	return nil
+}
+
+// CancelAll stops every running job, e.g. when the app closes.
+func (m *JobManager) CancelAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		j.cancel()
+	}
+}
+
+func (m *JobManager) Wait(id int) (domain.Job, error) {
+	m.mu.Lock()
+	j := m.find(id)
+	m.mu.Unlock()
+	if j == nil {
+		return domain.Job{}, fmt.Errorf("no job %d", id)
+	}
+	<-j.done
+	// from j itself, the job may have been pruned while it was waited for
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot(j), nil
+}
+
+func (m *JobManager) find(id int) *job {
+	for _, j := range m.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// snapshot copies a job with its output so far, under m.mu.
+func (m *JobManager) snapshot(j *job) domain.Job {
+	snap := j.Job
+	snap.Output = j.out.String()
+	return snap
+}
+
+// JobOutput collects what a job prints.
+type JobOutput struct {
+	m *JobManager
+	j *job
+}
+
+func (o *JobOutput) JobID() int {
+	return o.j.ID
+}
+
+func (o *JobOutput) WriteString(s string) {
+	if s == "" {
+		return
+	}
+	o.m.mu.Lock()
+	o.m.write(o.j, s)
+	o.m.mu.Unlock()
+}
+
+// Capture is middleware adding the output of every run to the job.
+func (o *JobOutput) Capture() execx.Middleware {
+	return func(next execx.Handler) execx.Handler {
+		return func(c execx.Call) (execx.Result, error) {
+			res, err := next(c)
+			o.WriteString(res.Stdout)
+			o.WriteString(res.Stderr)
+			return res, err
+		}
+	}
+}
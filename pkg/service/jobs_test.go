@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ourorg/goui/pkg/domain"
+)
+
+func TestJobOutputLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+	}{
+		{"exact fill then more", []string{strings.Repeat("a", maxJobOutput), "b"}},
+		{"separator past the limit", []string{strings.Repeat("a", maxJobOutput-1), "b", "c"}},
+		{"cut inside a rune", []string{strings.Repeat("a", maxJobOutput-1) + "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewJobManager()
+			j := m.Start("test", func(_ context.Context, out *JobOutput) (string, error) {
+				for _, w := range tt.writes {
+					out.WriteString(w)
+				}
+				return "", nil
+			})
+			got, err := m.Wait(j.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !utf8.ValidString(got.Output) {
+				t.Error("output is not valid UTF-8")
+			}
+			if max := maxJobOutput + len("\n\n[output truncated]"); len(got.Output) > max {
+				t.Errorf("output is %d bytes, want at most %d", len(got.Output), max)
+			}
+		})
+	}
+}
+
+func TestWaitOutlivesPrune(t *testing.T) {
+	m := NewJobManager()
+	release := make(chan struct{})
+	first := m.Start("first", func(context.Context, *JobOutput) (string, error) {
+		<-release
+		return "first done", nil
+	})
+	waited := make(chan domain.Job)
+	go func() {
+		j, _ := m.Wait(first.ID)
+		waited <- j
+	}()
+	// a running job is never pruned, give Wait time to find it first
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < DefaultJobsMax+5; i++ {
+		j := m.Start("filler", func(context.Context, *JobOutput) (string, error) { return "", nil })
+		m.Wait(j.ID)
+	}
+	j := <-waited
+	if j.ID != first.ID || j.Status != domain.JobDone || j.Output != "first done" {
+		t.Errorf("Wait returned %+v, want job %d done", j, first.ID)
+	}
+}
+
+func TestPanickingJobFails(t *testing.T) {
+	m := NewJobManager()
+	j := m.Start("boom", func(context.Context, *JobOutput) (string, error) {
+		panic("kaboom")
+	})
+	done := make(chan domain.Job, 1)
+	go func() {
+		got, _ := m.Wait(j.ID)
+		done <- got
+	}()
+	select {
+	case got := <-done:
+		if got.Status != domain.JobFailed || got.Err == nil || !strings.Contains(got.Err.Error(), "kaboom") {
+			t.Errorf("job = %s, %v, want failed with the panic value", got.Status, got.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the job panicked")
+	}
+}
@@ -1,6 +1,10 @@
 package service
 
+import "sync"
+
+// ModeService is safe for concurrent use.
 type ModeService struct {
+	mu      sync.Mutex
 	current int
 	modeReg *ModeRegistry
 }
@@ -10,9 +14,13 @@ func NewModeService(reg *ModeRegistry) *ModeService {
 }
 
 func (m *ModeService) SetMode(v int) {
+	m.mu.Lock()
 	m.current = v
+	m.mu.Unlock()
 }
 
 func (m *ModeService) CurrentMode() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.current
 }
\ No newline at end of file
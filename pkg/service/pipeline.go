@@ -0,0 +1,489 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ourorg/goui/pkg/query"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// Stage is one step of the SpecService filter pipeline. Stages read their
+// configuration from the state args and must not modify the slices of the
+// incoming spec in place, since those may be owned by the state args.
+type Stage interface {
+	Name() string
+	Apply(sp spec.Spec, args map[string]interface{}) (spec.Spec, error)
+}
+
+// Stage names of the built-in pipeline, usable with InsertStage.
+const (
+	StageSearch  = "search"
+	StageSort    = "sort"
+	StageGroup   = "group"
+	StageProject = "project"
+	StageLimit   = "limit"
+)
+
+// Args keys read by the built-in stages.
+const (
+	ArgSearchTerm = "searchTerm"
+	ArgSort       = "sort"          // string, e.g. "cpu desc, name", see ParseSort
+	ArgColumns    = "columns"       // []string or "a,b", shown columns in order
+	ArgHidden     = "hiddenColumns" // []string, columns marked not visible
+	ArgWidths     = "columnWidths"  // map[string]int, max width per column
+	ArgGroupBy    = "groupBy"       // string, column name
+	ArgLimit      = "limit"         // int, max rows, items or lines
+)
+
+type stageFunc struct {
+	name string
+	fn   func(spec.Spec, map[string]interface{}) (spec.Spec, error)
+}
+
+// NewStage adapts a function to a Stage.
+func NewStage(name string, fn func(spec.Spec, map[string]interface{}) (spec.Spec, error)) Stage {
+	return stageFunc{name: name, fn: fn}
+}
+
+func (s stageFunc) Name() string { return s.name }
+
+func (s stageFunc) Apply(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	return s.fn(sp, args)
+}
+
+// DefaultStages is the built-in pipeline: search, sort, group, project, limit.
+// Grouping runs before projection so hidden columns can still group rows.
+func DefaultStages() []Stage {
+	return []Stage{
+		NewStage(StageSearch, searchStage),
+		NewStage(StageSort, sortStage),
+		NewStage(StageGroup, groupStage),
+		NewStage(StageProject, projectStage),
+		NewStage(StageLimit, limitStage),
+	}
+}
+
+// Stages returns a copy of the current pipeline.
+func (s *SpecService) Stages() []Stage {
+	return append([]Stage(nil), s.stages...)
+}
+
+// SetStages replaces the whole pipeline.
+func (s *SpecService) SetStages(stages ...Stage) {
+	s.stages = append([]Stage(nil), stages...)
+}
+
+// AddStage appends custom stages at the end of the pipeline.
+func (s *SpecService) AddStage(stages ...Stage) {
+	s.stages = append(s.stages, stages...)
+}
+
+// InsertStage puts a stage right before the named one, or at the end when
+// no stage has that name.
+func (s *SpecService) InsertStage(before string, st Stage) {
+	for i, cur := range s.stages {
+		if cur.Name() == before {
+			s.stages = append(s.stages[:i], append([]Stage{st}, s.stages[i:]...)...)
+			return
+		}
+	}
+	s.stages = append(s.stages, st)
+}
+
+func searchStage(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	term, _ := args[ArgSearchTerm].(string)
+	if term == "" {
+		return sp, nil
+	}
+	if w := windowOf(sp); w != nil && w.Filtered {
+		return sp, nil
+	}
+	switch {
+	case sp.Table != nil:
+		t := *sp.Table
+		entries, err := filterEntries(t.Entries, t.Headers, t.ColSchema, term)
+		if err != nil {
+			return sp, err
+		}
+		t.Entries = entries
+		sp.Table = &t
+	case sp.List != nil:
+		l := *sp.List
+		l.Items = filterList(l.Items, term)
+		sp.List = &l
+	case sp.Text != nil:
+		t := *sp.Text
+		t.Body = filterText(t.Body, term)
+		sp.Text = &t
+	}
+	return sp, nil
+}
+
+// SortTerm is one column of a sort specification.
+type SortTerm struct {
+	Column string
+	Desc   bool
+}
+
+// ParseSort reads a sort specification like "cpu desc, name asc, age".
+func ParseSort(s string) ([]SortTerm, error) {
+	var out []SortTerm
+	for _, part := range strings.Split(s, ",") {
+		f := strings.Fields(part)
+		if len(f) == 0 {
+			continue
+		}
+		t := SortTerm{Column: f[0]}
+		if len(f) > 1 {
+			switch strings.ToLower(f[1]) {
+			case "desc":
+				t.Desc = true
+			case "asc":
+			default:
+				return nil, fmt.Errorf("expected asc or desc after %s, got %q", f[0], f[1])
+			}
+		}
+		if len(f) > 2 {
+			return nil, fmt.Errorf("unexpected %q in sort", strings.Join(f[2:], " "))
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// sortStage orders table entries by one or more columns, comparing cells by
+// the column type from the schema, or the type inferred from its cells.
+// Cells that do not parse as the type sort after those that do.
+func sortStage(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	s, _ := args[ArgSort].(string)
+	if s == "" || sp.Table == nil {
+		return sp, nil
+	}
+	if w := sp.Table.Window; w != nil && w.Sorted {
+		return sp, nil
+	}
+	terms, err := ParseSort(s)
+	if err != nil {
+		return sp, err
+	}
+	t := *sp.Table
+	entries, keys, err := sortEntries(t.Entries, t.Headers, t.ColSchema, terms)
+	if err != nil {
+		return sp, err
+	}
+	t.Entries = entries
+	t.SortKeys = keys
+	sp.Table = &t
+	return sp, nil
+}
+
+// sortEntries returns a sorted copy of entries and the matching sort keys.
+func sortEntries(in []spec.Entry, headers []string, schema []spec.ColMeta, terms []SortTerm) ([]spec.Entry, []spec.SortKey, error) {
+	keys, err := sortKeys(headers, terms)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := make([]string, len(keys))
+	for k, key := range keys {
+		if key.Col < len(schema) {
+			types[k] = schema[key.Col].Type
+		}
+		if types[k] == "" {
+			col := make([]string, len(in))
+			for i, e := range in {
+				col[i] = cell(e, key.Col)
+			}
+			types[k] = query.InferColumnType(col)
+		}
+	}
+
+	entries := append([]spec.Entry(nil), in...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		for k, key := range keys {
+			a, b := cell(entries[i], key.Col), cell(entries[j], key.Col)
+			c, ok := query.Compare(types[k], a, b)
+			if !ok {
+				if u := unparsedLast(types[k], a, b); u != 0 {
+					return u < 0
+				}
+				c = query.NaturalCompare(a, b)
+			}
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return entries, keys, nil
+}
+
+func sortKeys(headers []string, terms []SortTerm) ([]spec.SortKey, error) {
+	keys := make([]spec.SortKey, 0, len(terms))
+	for _, term := range terms {
+		idx, err := columnIndex(headers, term.Column)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, spec.SortKey{Col: idx, Desc: term.Desc})
+	}
+	return keys, nil
+}
+
+// unparsedLast keeps cells that do not parse as typ after those that do,
+// whatever the sort direction. It returns 0 when both parse or both fail.
+func unparsedLast(typ, a, b string) int {
+	_, okA := query.Compare(typ, a, a)
+	_, okB := query.Compare(typ, b, b)
+	switch {
+	case okA && !okB:
+		return -1
+	case !okA && okB:
+		return 1
+	}
+	return 0
+}
+
+// projectStage applies the column settings: ArgColumns selects and orders
+// columns, ArgHidden and ArgWidths update the schema that Table.Fit honors.
+func projectStage(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	if sp.Table == nil {
+		return sp, nil
+	}
+	t := *sp.Table
+	if names := stringList(args[ArgColumns]); len(names) > 0 {
+		idxs := make([]int, 0, len(names))
+		for _, n := range names {
+			i, err := columnIndex(t.Headers, n)
+			if err != nil {
+				return sp, err
+			}
+			idxs = append(idxs, i)
+		}
+		t = projectColumns(t, idxs)
+	}
+
+	hidden := stringList(args[ArgHidden])
+	widths, _ := args[ArgWidths].(map[string]int)
+	if len(hidden) == 0 && len(widths) == 0 {
+		sp.Table = &t
+		return sp, nil
+	}
+	schema := make([]spec.ColMeta, len(t.Headers))
+	copy(schema, t.ColSchema)
+	for _, n := range hidden {
+		if i, err := columnIndex(t.Headers, n); err == nil {
+			schema[i].Visible = false
+		}
+	}
+	for n, w := range widths {
+		if i, err := columnIndex(t.Headers, n); err == nil {
+			schema[i].MaxWidth = w
+		}
+	}
+	t.ColSchema = schema
+	sp.Table = &t
+	return sp, nil
+}
+
+func projectColumns(t spec.Table, idxs []int) spec.Table {
+	t.Headers = pick(t.Headers, idxs)
+	t.SortKeys = remapSortKeys(t.SortKeys, idxs)
+	if len(t.ColSchema) > 0 {
+		schema := make([]spec.ColMeta, len(idxs))
+		for k, i := range idxs {
+			if i < len(t.ColSchema) {
+				schema[k] = t.ColSchema[i]
+			}
+		}
+		t.ColSchema = schema
+	}
+	entries := make([]spec.Entry, len(t.Entries))
+	for n, e := range t.Entries {
+		e.Values = pick(e.Values, idxs)
+		if e.Matches != nil {
+			m := make([][]int, len(idxs))
+			for k, i := range idxs {
+				if i < len(e.Matches) {
+					m[k] = e.Matches[i]
+				}
+			}
+			e.Matches = m
+		}
+		entries[n] = e
+	}
+	t.Entries = entries
+	return t
+}
+
+// groupStage clusters entries by a column, groups in order of first
+// appearance and entries keeping their order within a group.
+func groupStage(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	col, _ := args[ArgGroupBy].(string)
+	if col == "" || sp.Table == nil {
+		return sp, nil
+	}
+	t := *sp.Table
+	idx, err := columnIndex(t.Headers, col)
+	if err != nil {
+		return sp, err
+	}
+	var keys []string
+	byKey := map[string][]spec.Entry{}
+	for _, e := range t.Entries {
+		k := cell(e, idx)
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], e)
+	}
+	entries := make([]spec.Entry, 0, len(t.Entries))
+	groups := make([]spec.Group, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, spec.Group{Key: k, Start: len(entries), Count: len(byKey[k])})
+		entries = append(entries, byKey[k]...)
+	}
+	t.Entries = entries
+	t.Groups = groups
+	sp.Table = &t
+	return sp, nil
+}
+
+func limitStage(sp spec.Spec, args map[string]interface{}) (spec.Spec, error) {
+	n, ok := intArg(args[ArgLimit])
+	if !ok || n <= 0 {
+		return sp, nil
+	}
+	switch {
+	case sp.Table != nil && len(sp.Table.Entries) > n:
+		t := *sp.Table
+		t.Entries = t.Entries[:n]
+		var groups []spec.Group
+		for _, g := range t.Groups {
+			if g.Start >= n {
+				break
+			}
+			if g.Start+g.Count > n {
+				g.Count = n - g.Start
+			}
+			groups = append(groups, g)
+		}
+		if t.Groups != nil {
+			t.Groups = groups
+		}
+		sp.Table = &t
+	case sp.List != nil && len(sp.List.Items) > n:
+		l := *sp.List
+		l.Items = l.Items[:n]
+		sp.List = &l
+	case sp.Text != nil:
+		lines := strings.Split(sp.Text.Body, "\n")
+		if len(lines) > n {
+			t := *sp.Text
+			t.Body = strings.Join(lines[:n], "\n")
+			sp.Text = &t
+		}
+	}
+	return sp, nil
+}
+
+// remapSortKeys follows sort keys to their projected column, dropping hidden ones.
+func remapSortKeys(keys []spec.SortKey, idxs []int) []spec.SortKey {
+	if keys == nil {
+		return nil
+	}
+	out := []spec.SortKey{}
+	for _, k := range keys {
+		for n, i := range idxs {
+			if i == k.Col {
+				out = append(out, spec.SortKey{Col: n, Desc: k.Desc})
+				break
+			}
+		}
+	}
+	return out
+}
+
+func windowOf(sp spec.Spec) *spec.Window {
+	switch {
+	case sp.Table != nil:
+		return sp.Table.Window
+	case sp.List != nil:
+		return sp.List.Window
+	}
+	return nil
+}
+
+// columnIndex finds a header case-insensitively.
+func columnIndex(headers []string, name string) (int, error) {
+	for i, h := range headers {
+		if strings.EqualFold(h, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column %q", name)
+}
+
+func cell(e spec.Entry, i int) string {
+	if i < len(e.Values) {
+		return e.Values[i]
+	}
+	return ""
+}
+
+func pick(vals []string, idxs []int) []string {
+	out := make([]string, len(idxs))
+	for k, i := range idxs {
+		if i < len(vals) {
+			out[k] = vals[i]
+		}
+	}
+	return out
+}
+
+// stringList accepts []string or a comma separated string.
+func stringList(v interface{}) []string {
+	switch x := v.(type) {
+	case []string:
+		return x
+	case string:
+		var out []string
+		for _, p := range strings.Split(x, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// intArg accepts the int types apps use as well as numeric strings and
+// the float64 a JSON round trip produces.
+func intArg(v interface{}) (int, bool) {
+	switch x := v.(type) {
+	case int:
+		return x, true
+	case int64:
+		return int(x), true
+	case float64:
+		return int(x), true
+	case string:
+		n, err := strconv.Atoi(x)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func joinInfo(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "; " + b
+}
@@ -18,17 +18,28 @@ type StateProvider interface {
 	Init(initialID int) error
 	Current() *domain.State
 	SetNextState(toID int, mutateArgs func(map[string]interface{})) error
+	UpdateArgs(mutateArgs func(map[string]interface{})) error
 	History() StateHistory
+	Restore(currentID int, args map[string]interface{}, hist StateHistory) error
 	Undo() bool
 	Redo() bool
-	Push(id int) error
+	// Push opens a state on top of the navigation stack, Pop returns to the
+	// state below it with the args it had
+	Push(id int, mutateArgs func(map[string]interface{})) error
 	Pop() error
+	Breadcrumbs() []string
+	// OnChange observes every commit with its cause, e.g. Undo or Pop
+	OnChange(fn func(StateChange)) func()
+	// Sorts are the sort specifications states keep across visits
+	Sorts() map[int]string
+	RestoreSorts(sorts map[int]string)
 }
 
 // StateWriter is the write-only subset Engine exposes to UIs and commands.
 type StateWriter interface {
 	SetNextState(id int, mutateArgs func(map[string]interface{})) error
-	Push(id int) error
+	UpdateArgs(mutateArgs func(map[string]interface{})) error
+	Push(id int, mutateArgs func(map[string]interface{})) error
 	Pop() error
 }
 
@@ -53,6 +64,8 @@ type CommandProvider interface {
 	TouchHistory(cmd string)
 	Resolve(alias string) (*domain.Command, bool)
 	Dispatch(alias string, args []string) (string, error)
+	History() *CmdHistory
+	Jobs() *JobManager
 }
 
 // Simple history structs to mirror the diagram.
@@ -61,9 +74,30 @@ type Transition struct {
 	ToID   int
 	Cause  string
 	At     time.Time
+	// Args of both ends, so undo and redo return to drill-down views with
+	// the args they were opened with
+	FromArgs map[string]interface{} `json:",omitempty"`
+	ToArgs   map[string]interface{} `json:",omitempty"`
+}
+
+// StateChange is a state StateService committed, From is nil for the first.
+type StateChange struct {
+	From  *domain.State
+	To    *domain.State
+	Cause string
+}
+
+// NavFrame is a state below the current one on the navigation stack, with
+// a snapshot of its args and the name they rendered to.
+type NavFrame struct {
+	StateID int
+	Name    string
+	Args    map[string]interface{}
 }
 
 type StateHistory struct {
 	Undo []Transition
 	Redo []Transition
+	// Drill-down frames below the current state, see Push
+	Stack []NavFrame `json:",omitempty"`
 }
\ No newline at end of file
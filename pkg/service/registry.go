@@ -46,11 +46,16 @@ func (r *StateRegistry) Invalidate() {
 	r.mu.Unlock()
 }
 
-// Backward compatible helper
+// Backward compatible helper, returns a copy, args included
 func (r *StateRegistry) GetStates() []domain.State {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.states
+	out := make([]domain.State, len(r.states))
+	for i, s := range r.states {
+		s.Args = copyArgs(s.Args)
+		out[i] = s
+	}
+	return out
 }
 
 type ModeRegistry struct {
@@ -84,11 +89,11 @@ func (r *ModeRegistry) Invalidate() {
 	r.mu.Unlock()
 }
 
-// Backward compatible helper
+// Backward compatible helper, returns a copy
 func (r *ModeRegistry) GetModes() []domain.Mode {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.modes
+	return append([]domain.Mode(nil), r.modes...)
 }
 
 type CommandRegistry struct {
@@ -124,11 +129,19 @@ func (r *CommandRegistry) Invalidate() {
 	r.mu.Unlock()
 }
 
-// Backward compatible helper
+// Backward compatible helper, returns copies of the commands, so callers
+// cannot change what the registry dispatches
 func (r *CommandRegistry) GetCommands() []*domain.Command {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.commands
+	out := make([]*domain.Command, len(r.commands))
+	for i, c := range r.commands {
+		cp := *c
+		cp.Aliases = append([]string(nil), c.Aliases...)
+		cp.Args = append([]string(nil), c.Args...)
+		out[i] = &cp
+	}
+	return out
 }
 
 // Backward compatible facade used by apps today
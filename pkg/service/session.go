@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/execx"
+	"github.com/ourorg/goui/pkg/secret"
+)
+
+const sessionVersion = 1
+
+// Session is the on-disk snapshot restored on the next launch.
+type Session struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+
+	// Current state and the scalar args it was showing (search term etc.)
+	StateID   int                    `json:"stateID"`
+	StateArgs map[string]interface{} `json:"stateArgs,omitempty"`
+
+	// Sort specification per state ID, see ParseSort
+	Sorts map[int]string `json:"sorts,omitempty"`
+
+	History  StateHistory      `json:"history"`
+	Commands []CmdHistoryEntry `json:"commands,omitempty"`
+	ExecMode execx.Mode        `json:"execMode"`
+	// Exec profile name, restored when the app still configures it
+	ExecProfile string `json:"execProfile,omitempty"`
+}
+
+// SessionStore reads and writes a Session as JSON at a fixed path.
+type SessionStore struct {
+	path string
+}
+
+func NewSessionStore(path string) *SessionStore {
+	return &SessionStore{path: path}
+}
+
+func (s *SessionStore) Path() string {
+	return s.path
+}
+
+// Load returns nil without error when no session was saved yet.
+func (s *SessionStore) Load() (*Session, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	if sess.Version != sessionVersion {
+		logrus.Warnf("Ignoring session %s with version %d", s.path, sess.Version)
+		return nil, nil
+	}
+	intArgs(sess.StateArgs)
+	for _, ts := range [][]Transition{sess.History.Undo, sess.History.Redo} {
+		for _, t := range ts {
+			intArgs(t.FromArgs)
+			intArgs(t.ToArgs)
+		}
+	}
+	for _, f := range sess.History.Stack {
+		intArgs(f.Args)
+	}
+	return &sess, nil
+}
+
+// intArgs turns whole JSON numbers, which come back as float64, into the
+// ints offsets and limits are.
+func intArgs(args map[string]interface{}) {
+	for k, v := range args {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) <= math.MaxInt32 {
+			args[k] = int(f)
+		}
+	}
+}
+
+// Save writes through a temp file and rename so a crash never leaves half a session.
+func (s *SessionStore) Save(sess *Session) error {
+	sess.Version = sessionVersion
+	sess.SavedAt = time.Now()
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SessionArgs keeps only scalar args: strings, bools and numbers, which
+// Load turns back into ints where they were whole. Entries, rows and other
+// typed values are rebuilt by the app on launch. Resolved secrets are
+// masked, they are never written to disk.
+func SessionArgs(args map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range args {
+		switch v := v.(type) {
+		case string:
+			out[k] = secret.Redact(v)
+		case bool, int, int64, float64:
+			out[k] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// SessionHistory is h with only scalar args kept, see SessionArgs.
+func SessionHistory(h StateHistory) StateHistory {
+	scalar := func(ts []Transition) []Transition {
+		out := make([]Transition, len(ts))
+		for i, t := range ts {
+			t.FromArgs, t.ToArgs = SessionArgs(t.FromArgs), SessionArgs(t.ToArgs)
+			out[i] = t
+		}
+		return out
+	}
+	out := StateHistory{Undo: scalar(h.Undo), Redo: scalar(h.Redo)}
+	for _, f := range h.Stack {
+		f.Args = SessionArgs(f.Args)
+		out.Stack = append(out.Stack, f)
+	}
+	return out
+}
+
+// PruneHistory drops transitions and drill-down frames that point at states
+// no longer registered.
+func PruneHistory(h StateHistory, states map[int]domain.State) StateHistory {
+	keep := func(ts []Transition) []Transition {
+		var out []Transition
+		for _, t := range ts {
+			if _, ok := states[t.ToID]; !ok {
+				continue
+			}
+			if _, ok := states[t.FromID]; !ok && t.FromID >= 0 {
+				continue
+			}
+			out = append(out, t)
+		}
+		return out
+	}
+	out := StateHistory{Undo: keep(h.Undo), Redo: keep(h.Redo)}
+	for _, f := range h.Stack {
+		if _, ok := states[f.StateID]; ok {
+			out.Stack = append(out.Stack, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// Args keys for windowed states, see BuildSpec.
+const (
+	ArgSource   = "source"   // spec.Source[spec.Entry] or spec.Source[spec.ListItem]
+	ArgOffset   = "offset"   // int, first row of the page
+	ArgPageSize = "pageSize" // int, rows per page
+)
+
+// DefaultPageSize is used when a windowed state sets no page size.
+const DefaultPageSize = 100
+
+// maxDerived bounds the filtered and sorted views a SliceSource caches.
+const maxDerived = 16
+
+// SliceSource is an in-memory table source with filter and sort pushdown.
+// Filtered and sorted views are computed once per term and cached, so
+// rebuilding a spec while scrolling only copies the visible page.
+type SliceSource struct {
+	headers []string
+	schema  []spec.ColMeta
+	entries []spec.Entry
+
+	mu      sync.Mutex
+	derived map[string]*SliceSource
+}
+
+// NewSliceSource wraps entries, headers and schema are used to resolve
+// column names in queries and sort specifications.
+func NewSliceSource(headers []string, schema []spec.ColMeta, entries []spec.Entry) *SliceSource {
+	return &SliceSource{headers: headers, schema: schema, entries: entries}
+}
+
+func (s *SliceSource) Len() int { return len(s.entries) }
+
+func (s *SliceSource) Fetch(offset, limit int) []spec.Entry {
+	if offset < 0 { offset = 0 }
+	if offset >= len(s.entries) || limit <= 0 { return nil }
+	end := offset + limit
+	if end > len(s.entries) { end = len(s.entries) }
+	return s.entries[offset:end]
+}
+
+func (s *SliceSource) Filter(term string) (spec.Source[spec.Entry], error) {
+	if strings.TrimSpace(term) == "" { return s, nil }
+	return s.derive("filter:"+term, func() ([]spec.Entry, error) {
+		return filterEntries(s.entries, s.headers, s.schema, term)
+	})
+}
+
+func (s *SliceSource) Sort(sortSpec string) (spec.Source[spec.Entry], error) {
+	if strings.TrimSpace(sortSpec) == "" { return s, nil }
+	return s.derive("sort:"+sortSpec, func() ([]spec.Entry, error) {
+		terms, err := ParseSort(sortSpec)
+		if err != nil { return nil, err }
+		entries, _, err := sortEntries(s.entries, s.headers, s.schema, terms)
+		return entries, err
+	})
+}
+
+func (s *SliceSource) derive(key string, build func() ([]spec.Entry, error)) (spec.Source[spec.Entry], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.derived[key]; ok { return d, nil }
+	entries, err := build()
+	if err != nil { return nil, err }
+	if s.derived == nil || len(s.derived) >= maxDerived {
+		s.derived = map[string]*SliceSource{}
+	}
+	d := NewSliceSource(s.headers, s.schema, entries)
+	s.derived[key] = d
+	return d, nil
+}
+
+// windowEntries fetches the page of a table source selected by the state
+// args, pushing the search term and sort down when the source supports it.
+// Sources that cannot filter or sort themselves are read in full first, so
+// the page and Window.Total always reflect every row. A failing pushdown is
+// reported and the page is served without it.
+func windowEntries(src spec.Source[spec.Entry], headers []string, schema []spec.ColMeta, args map[string]interface{}) ([]spec.Entry, []spec.SortKey, *spec.Window, error) {
+	w := &spec.Window{}
+	var errs []string
+	if term, _ := args[ArgSearchTerm].(string); term != "" {
+		f, ok := src.(spec.Filterable[spec.Entry])
+		if !ok {
+			f = NewSliceSource(headers, schema, src.Fetch(0, src.Len()))
+		}
+		if filtered, err := f.Filter(term); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			src, w.Filtered = filtered, true
+		}
+	}
+	var keys []spec.SortKey
+	if sortSpec, _ := args[ArgSort].(string); sortSpec != "" {
+		so, ok := src.(spec.Sortable[spec.Entry])
+		if !ok {
+			so = NewSliceSource(headers, schema, src.Fetch(0, src.Len()))
+		}
+		terms, err := ParseSort(sortSpec)
+		if err == nil {
+			keys, err = sortKeys(headers, terms)
+		}
+		var sorted spec.Source[spec.Entry]
+		if err == nil {
+			sorted, err = so.Sort(sortSpec)
+		}
+		if err != nil {
+			keys = nil
+			errs = append(errs, err.Error())
+		} else {
+			src, w.Sorted = sorted, true
+		}
+	}
+	setWindow(w, src.Len(), args)
+	var err error
+	if len(errs) > 0 { err = errors.New(strings.Join(errs, "; ")) }
+	return src.Fetch(w.Offset, w.Size), keys, w, err
+}
+
+// windowItems is windowEntries for list sources, with search pushdown only.
+func windowItems(src spec.Source[spec.ListItem], args map[string]interface{}) ([]spec.ListItem, *spec.Window, error) {
+	w := &spec.Window{}
+	var err error
+	if term, _ := args[ArgSearchTerm].(string); term != "" {
+		if f, ok := src.(spec.Filterable[spec.ListItem]); ok {
+			var filtered spec.Source[spec.ListItem]
+			if filtered, err = f.Filter(term); err == nil {
+				src, w.Filtered = filtered, true
+			}
+		} else {
+			src, w.Filtered = itemSlice(filterList(src.Fetch(0, src.Len()), term)), true
+		}
+	}
+	setWindow(w, src.Len(), args)
+	return src.Fetch(w.Offset, w.Size), w, err
+}
+
+// setWindow clamps the requested offset so the last page stays full.
+func setWindow(w *spec.Window, total int, args map[string]interface{}) {
+	size, ok := intArg(args[ArgPageSize])
+	if !ok || size <= 0 { size = DefaultPageSize }
+	offset, _ := intArg(args[ArgOffset])
+	w.Size, w.Total = size, total
+	w.Offset = ClampOffset(offset, w)
+}
+
+// itemSlice serves list items already in memory, e.g. the filtered rows of
+// a list source that cannot filter itself.
+type itemSlice []spec.ListItem
+
+func (s itemSlice) Len() int { return len(s) }
+
+func (s itemSlice) Fetch(offset, limit int) []spec.ListItem {
+	if offset < 0 { offset = 0 }
+	if offset >= len(s) || limit <= 0 { return nil }
+	end := offset + limit
+	if end > len(s) { end = len(s) }
+	return s[offset:end]
+}
+
+var (
+	_ spec.Filterable[spec.Entry] = (*SliceSource)(nil)
+	_ spec.Sortable[spec.Entry]   = (*SliceSource)(nil)
+)
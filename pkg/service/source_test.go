@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+func makeEntries(n int) []spec.Entry {
+	out := make([]spec.Entry, n)
+	for i := range out {
+		out[i] = spec.Entry{ID: fmt.Sprint(i), Values: []string{fmt.Sprintf("pod-%d", i), fmt.Sprint(i % 100)}}
+	}
+	return out
+}
+
+func tableState(src spec.Source[spec.Entry], args map[string]interface{}) *domain.State {
+	a := map[string]interface{}{"headers": []string{"Name", "CPU"}, ArgSource: src, ArgPageSize: 50}
+	for k, v := range args {
+		a[k] = v
+	}
+	return &domain.State{ID: 1, LayoutKind: domain.DisplayTable, Args: a}
+}
+
+// pageOnly hides the pushdowns of a SliceSource
+type pageOnly struct{ src *SliceSource }
+
+func (p pageOnly) Len() int                             { return p.src.Len() }
+func (p pageOnly) Fetch(offset, limit int) []spec.Entry { return p.src.Fetch(offset, limit) }
+
+func TestWindowFiltersWholeSourceWithoutPushdown(t *testing.T) {
+	headers := []string{"Name", "CPU"}
+	src := NewSliceSource(headers, nil, makeEntries(1000))
+	want, err := filterEntries(src.entries, headers, nil, "pod-99")
+	if err != nil || len(want) == 0 {
+		t.Fatalf("filterEntries: %d entries, %v", len(want), err)
+	}
+	for _, s := range []spec.Source[spec.Entry]{src, pageOnly{src}} {
+		sp := NewSpecService().BuildSpec(tableState(s, map[string]interface{}{ArgSearchTerm: "pod-99", ArgSort: "Name desc", ArgPageSize: 5}))
+		tbl := sp.Table
+		if tbl.Window.Total != len(want) || len(tbl.Entries) != 5 {
+			t.Fatalf("%T: total %d, %d entries, want %d and a page of 5", s, tbl.Window.Total, len(tbl.Entries), len(want))
+		}
+		if got := tbl.Entries[0].Values[0]; got != "pod-999" {
+			t.Errorf("%T: first entry %s, want pod-999", s, got)
+		}
+	}
+}
+
+// BenchmarkBuildSpecWindow rebuilds a sorted, filtered page. Filter and sort
+// results are cached by the source, so the cost per build stays flat as the
+// source grows.
+func BenchmarkBuildSpecWindow(b *testing.B) {
+	for _, n := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			src := NewSliceSource([]string{"Name", "CPU"}, nil, makeEntries(n))
+			st := tableState(src, map[string]interface{}{ArgSearchTerm: "pod-1", ArgSort: "CPU desc", ArgOffset: 500})
+			svc := NewSpecService()
+			svc.BuildSpec(st) // warm the caches
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				svc.BuildSpec(st)
+			}
+		})
+	}
+}
@@ -4,45 +4,47 @@ import (
 	"strings"
 
 	"github.com/ourorg/goui/pkg/domain"
+	"github.com/ourorg/goui/pkg/fuzzy"
+	"github.com/ourorg/goui/pkg/query"
 	"github.com/ourorg/goui/pkg/spec"
 )
 
-type SpecService struct{}
+type SpecService struct {
+	stages []Stage
+}
 
-func NewSpecService() *SpecService { return &SpecService{} }
+// NewSpecService builds specs and runs them through DefaultStages.
+func NewSpecService() *SpecService { return &SpecService{stages: DefaultStages()} }
 
 // helpers kept from old StateManager
 func containsCI(hay, needle string) bool {
 	return strings.Contains(strings.ToLower(hay), strings.ToLower(needle))
 }
 
-func filterRows(rows [][]string, term string) [][]string {
-	if term == "" { return rows }
-	var out [][]string
-	for _, r := range rows {
-		for _, c := range r {
-			if containsCI(c, term) { out = append(out, r); break }
-		}
-	}
-	return out
-}
-
-func filterEntries(entries []spec.Entry, term string) []spec.Entry {
-	if term == "" { return entries }
+// filterEntries runs the search term as a query (see package query) bound to
+// the table columns. A bad query leaves the entries unfiltered.
+func filterEntries(entries []spec.Entry, headers []string, schema []spec.ColMeta, term string) ([]spec.Entry, error) {
+	if strings.TrimSpace(term) == "" { return entries, nil }
+	q, err := query.Compile(term, query.FromTable(headers, schema))
+	if err != nil { return entries, err }
 	var out []spec.Entry
 	for _, e := range entries {
-		for _, v := range e.Values {
-			if containsCI(v, term) { out = append(out, e); break }
+		if q.Match(e.Values) {
+			e.Matches = q.Highlight(e.Values)
+			out = append(out, e)
 		}
 	}
-	return out
+	return out, nil
 }
 
 func filterList(items []spec.ListItem, term string) []spec.ListItem {
 	if term == "" { return items }
 	var out []spec.ListItem
 	for _, it := range items {
-		if containsCI(it.Main, term) || containsCI(it.Secondary, term) {
+		main, okMain := fuzzy.Match(term, it.Main)
+		_, okSecondary := fuzzy.Match(term, it.Secondary)
+		if okMain || okSecondary {
+			it.Matches = main.Positions
 			out = append(out, it)
 		}
 	}
@@ -63,8 +65,6 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 	if st == nil {
 		return spec.Spec{Kind: spec.KindText, Text: &spec.Text{Body: "no state"}}
 	}
-	searchTerm, _ := st.Args["searchTerm"].(string)
-
 	switch st.LayoutKind {
 	case domain.DisplayTable:
 		title := "Items"
@@ -75,7 +75,15 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 
 		// Build entries, keeping Rows as a fallback for older screens
 		var entries []spec.Entry
-		if en, ok := st.Args["entries"].([]spec.Entry); ok && len(en) > 0 {
+		var window *spec.Window
+		var sortKeys []spec.SortKey
+		var info string
+		if src, ok := st.Args[ArgSource].(spec.Source[spec.Entry]); ok {
+			// Only the visible page is materialized for big sources
+			var err error
+			entries, sortKeys, window, err = windowEntries(src, headers, colSchema(st.Args, len(headers)), st.Args)
+			if err != nil { info = "source: " + err.Error() }
+		} else if en, ok := st.Args["entries"].([]spec.Entry); ok && len(en) > 0 {
 			entries = en
 		} else {
 			// Make entries from rows, derive IDs from id_col if present
@@ -84,9 +92,6 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 			rows := [][]string{{"item_1"}, {"item_2"}}
 			if r, ok := st.Args["rows"].([][]string); ok && len(r) > 0 { rows = r }
 
-			// Apply filtering first on rows if we use them
-			rows = filterRows(rows, searchTerm)
-
 			for _, r := range rows {
 				id := ""
 				if idCol >= 0 && idCol < len(r) { id = r[idCol] }
@@ -94,25 +99,26 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 			}
 		}
 
-		// Final filter on entries to support both paths
-		entries = filterEntries(entries, searchTerm)
-
 		// Selection comes from state args, optional
 		var sel []string
-		if v, ok := st.Args["selection"].([]string); ok && len(v) > 0 {
+		if v, ok := st.Args[ArgSelection].([]string); ok && len(v) > 0 {
 			sel = append(sel, v...)
 		}
 
 		return spec.Spec{
 			Kind: spec.KindTable,
 			Table: &spec.Table{
-				Title:    title,
-				Headers:  headers,
-				Entries:  entries,
+				Title:     title,
+				Headers:   headers,
+				ColSchema: colSchema(st.Args, len(headers)),
+				Entries:   entries,
 				// Keep Rows for compatibility so older renderers still show something
 				Rows:     valuesFromEntries(entries),
+				SortKeys:  sortKeys,
+				Window:    window,
 			},
 			Selection: sel,
+			Info:      info,
 		}
 
 	case domain.DisplayList:
@@ -120,31 +126,36 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 			{Main: "Default 1", Secondary: "Description 1"},
 			{Main: "Default 2", Secondary: "Description 2"},
 		}
-		if li, ok := st.Args["list"].([]spec.ListItem); ok && len(li) > 0 {
+		var window *spec.Window
+		var info string
+		if src, ok := st.Args[ArgSource].(spec.Source[spec.ListItem]); ok {
+			var err error
+			items, window, err = windowItems(src, st.Args)
+			if err != nil { info = "source: " + err.Error() }
+		} else if li, ok := st.Args["list"].([]spec.ListItem); ok && len(li) > 0 {
 			items = li
 		}
 
-		items = filterList(items, searchTerm)
-
 		// Optional list selection, we use item Main as ID by default
 		var sel []string
-		if v, ok := st.Args["selection"].([]string); ok && len(v) > 0 {
+		if v, ok := st.Args[ArgSelection].([]string); ok && len(v) > 0 {
 			sel = append(sel, v...)
 		}
 
 		return spec.Spec{
 			Kind: spec.KindList,
 			List: &spec.List{
-				Title: "List",
-				Items: items,
+				Title:  "List",
+				Items:  items,
+				Window: window,
 			},
 			Selection: sel,
+			Info:      info,
 		}
 
 	default:
 		body := "Default text content\nApps should provide custom content"
 		if s, ok := st.Args["text"].(string); ok && s != "" { body = s }
-		body = filterText(body, searchTerm)
 		return spec.Spec{
 			Kind: spec.KindText,
 			Text: &spec.Text{Title: st.ShortName(), Body: body},
@@ -152,11 +163,46 @@ func (s *SpecService) BuildSpec(st *domain.State) spec.Spec {
 	}
 }
 
+// ApplyFilter runs the spec through the pipeline stages in order. A failing
+// stage is skipped and its error reported through the spec's info message.
 func (s *SpecService) ApplyFilter(sp spec.Spec, args map[string]interface{}) spec.Spec {
-	// optional custom filtering stage, keeping it as passthrough for now
+	if args == nil { args = map[string]interface{}{} }
+	for _, st := range s.stages {
+		next, err := st.Apply(sp, args)
+		if err != nil {
+			sp.Info = joinInfo(sp.Info, st.Name()+": "+err.Error())
+			continue
+		}
+		sp = next
+	}
+	if sp.Table != nil {
+		sp.Table.Rows = valuesFromEntries(sp.Table.Entries)
+	}
 	return sp
 }
 
+// colSchema returns one ColMeta per header, from the "colSchema" arg when
+// the app declares one. Declared schemas that mark no column visible are
+// treated as all visible so apps can set only types or priorities, and
+// headers past the end of a shorter schema are visible.
+func colSchema(args map[string]interface{}, n int) []spec.ColMeta {
+	out := make([]spec.ColMeta, n)
+	declared, _ := args["colSchema"].([]spec.ColMeta)
+	anyVisible := false
+	for i := range out {
+		if i < len(declared) {
+			out[i] = declared[i]
+			anyVisible = anyVisible || declared[i].Visible
+		} else {
+			out[i].Visible = true
+		}
+	}
+	if !anyVisible {
+		for i := range out { out[i].Visible = true }
+	}
+	return out
+}
+
 func valuesFromEntries(es []spec.Entry) [][]string {
 	out := make([][]string, 0, len(es))
 	for _, e := range es { out = append(out, e.Values) }
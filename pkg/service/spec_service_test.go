@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+func TestColSchemaDefaultsMissingColumnsToVisible(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared []spec.ColMeta
+		want     []bool
+	}{
+		{"none", nil, []bool{true, true, true}},
+		{"types only", []spec.ColMeta{{Type: spec.ColNumber}}, []bool{true, true, true}},
+		{"shorter", []spec.ColMeta{{Visible: true}, {Visible: false}}, []bool{true, false, true}},
+		{"full", []spec.ColMeta{{Visible: false}, {Visible: true}, {Visible: false}}, []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		got := colSchema(map[string]interface{}{"colSchema": tt.declared}, 3)
+		for i, m := range got {
+			if m.Visible != tt.want[i] {
+				t.Errorf("%s: column %d visible = %v, want %v", tt.name, i, m.Visible, tt.want[i])
+			}
+		}
+	}
+}
@@ -1,69 +1,40 @@
 package service
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/ourorg/goui/pkg/domain"
 )
 
-type DefaultStateStore struct {
-	mu     sync.RWMutex
-	curr   *domain.State
-	subs   []func(*domain.State)
+// StateService is safe for concurrent use. Observers are called after its
+// lock is released, in commit order, so they may call back into it.
+type StateService struct {
+	mu       sync.Mutex
+	store    StateStore
+	history  StateHistory
 	stateReg *StateRegistry
-}
 
-func NewDefaultStateStore(reg *StateRegistry) *DefaultStateStore {
-	return &DefaultStateStore{stateReg: reg}
-}
+	// Drill-down navigation, emptied by any other kind of transition
+	stack []NavFrame
 
-func (s *DefaultStateStore) Init(initialID int) error {
-	if s.stateReg == nil { return nil }
-	stIdx := s.stateReg.Index()
-	if len(stIdx) == 0 { return nil }
-	curr := stIdx[initialID]
-	s.Commit(func(_ *domain.State) (*domain.State, bool) { return &curr, true })
-	return nil
-}
+	// Told about every commit, see OnChange. obsMu guards these and is
+	// taken after mu when both are held.
+	obsMu      sync.Mutex
+	observers  []observer
+	obsSeq     int
+	pending    []StateChange // commits waiting for notification
+	delivering bool          // a goroutine is draining pending
 
-func (s *DefaultStateStore) Current() *domain.State {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.curr
+	// Sort specification per state ID, kept apart from the registry's args
+	// so a sort sticks to its state across visits, see Sorts
+	sorts map[int]string
 }
 
-func (s *DefaultStateStore) Commit(f func(*domain.State) (*domain.State, bool)) (*domain.State, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	next, ok := f(s.curr)
-	if ok {
-		s.curr = next
-		for _, fn := range s.subs {
-			if fn != nil { fn(s.curr) }
-		}
-	}
-	return s.curr, ok
-}
-
-func (s *DefaultStateStore) Subscribe(fn func(*domain.State)) func() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.subs = append(s.subs, fn)
-	idx := len(s.subs) - 1
-	return func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		if idx < len(s.subs) {
-			s.subs[idx] = nil
-		}
-	}
-}
-
-type StateService struct {
-	store    StateStore
-	history  StateHistory
-	stateReg *StateRegistry
+type observer struct {
+	id int
+	fn func(StateChange)
 }
 
 func NewStateService(store StateStore, reg *StateRegistry) *StateService {
@@ -71,12 +42,17 @@ func NewStateService(store StateStore, reg *StateRegistry) *StateService {
 }
 
 func (s *StateService) Init(initialID int) error {
+	s.mu.Lock()
+	defer s.unlock()
 	// set first state as current
 	if s.stateReg == nil { return nil }
 	stIdx := s.stateReg.Index()
 	if len(stIdx) == 0 { return nil }
-	curr := stIdx[initialID]
-	s.store.Commit(func(_ *domain.State) (*domain.State, bool) { return &curr, true })
+	curr, ok := s.stateFor(stIdx, initialID)
+	if !ok {
+		return fmt.Errorf("no state found with ID: %d", initialID)
+	}
+	s.commit(&curr, "Init")
 	return nil
 }
 
@@ -85,42 +61,96 @@ func (s *StateService) Current() *domain.State {
 }
 
 func (s *StateService) SetNextState(toID int, mutateArgs func(map[string]interface{})) error {
+	s.mu.Lock()
+	defer s.unlock()
+	ok, err := s.transition(toID, mutateArgs, "SetNextState")
+	if ok {
+		s.stack = nil
+	}
+	return err
+}
+
+// transition moves to toID and records it for undo, false if toID is
+// unknown. Called with s.mu held, like commit.
+func (s *StateService) transition(toID int, mutateArgs func(map[string]interface{}), cause string) (bool, error) {
 	curr := s.store.Current()
 	fromID := -1
-	if curr != nil { fromID = curr.ID }
+	var fromArgs map[string]interface{}
+	if curr != nil { fromID, fromArgs = curr.ID, curr.Args }
 
-	stateMap := s.stateReg.Index()
-	next, ok := stateMap[toID]
+	cp, ok := s.stateFor(s.stateReg.Index(), toID)
 	if !ok {
 		// Stay in current state if target doesn't exist
-		return nil
+		return false, nil
 	}
-
-	// copy to avoid mutating registry copy
-	cp := next
-	if cp.Args == nil { cp.Args = map[string]interface{}{} }
 	if mutateArgs != nil { mutateArgs(cp.Args) }
 
-	s.store.Commit(func(_ *domain.State) (*domain.State, bool) { return &cp, true })
+	s.commit(&cp, cause)
 
 	// Record transition for undo/redo
+	// committed args are never changed in place, sharing them is safe
 	s.history.Undo = append(s.history.Undo, Transition{
 		FromID: fromID,
 		ToID: toID,
-		Cause: "SetNextState",
+		Cause: cause,
 		At: time.Now(),
+		FromArgs: fromArgs,
+		ToArgs: cp.Args,
 	})
 	// Clear redo stack when new action occurs
 	s.history.Redo = nil
 
+	return true, nil
+}
+
+// UpdateArgs changes the current state's args in place, without recording
+// a transition, and notifies store subscribers.
+func (s *StateService) UpdateArgs(mutateArgs func(map[string]interface{})) error {
+	s.mu.Lock()
+	defer s.unlock()
+	curr := s.store.Current()
+	if curr == nil { return fmt.Errorf("no current state") }
+	cp := *curr
+	cp.Args = copyArgs(curr.Args)
+	if mutateArgs != nil { mutateArgs(cp.Args) }
+	s.commit(&cp, "UpdateArgs")
 	return nil
 }
 
+// History returns a copy of the undo and redo stacks.
 func (s *StateService) History() StateHistory {
-	return s.history
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StateHistory{
+		Undo:  append([]Transition(nil), s.history.Undo...),
+		Redo:  append([]Transition(nil), s.history.Redo...),
+		Stack: append([]NavFrame(nil), s.stack...),
+	}
+}
+
+// Restore puts back a saved state and history without recording a transition.
+// Unknown state IDs are reported so callers can fall back to the initial state.
+func (s *StateService) Restore(currentID int, args map[string]interface{}, hist StateHistory) error {
+	s.mu.Lock()
+	defer s.unlock()
+	stateMap := s.stateReg.Index()
+	curr, ok := s.stateFor(stateMap, currentID)
+	if !ok {
+		return fmt.Errorf("no state found with ID: %d", currentID)
+	}
+	for k, v := range args {
+		curr.Args[k] = v
+	}
+	s.commit(&curr, "Restore")
+	hist = PruneHistory(hist, stateMap)
+	s.history = StateHistory{Undo: hist.Undo, Redo: hist.Redo}
+	s.stack = hist.Stack
+	return nil
 }
 
 func (s *StateService) Undo() bool {
+	s.mu.Lock()
+	defer s.unlock()
 	if len(s.history.Undo) == 0 { return false }
 
 	// Pop from undo stack
@@ -130,13 +160,12 @@ func (s *StateService) Undo() bool {
 	// Move the undone transition to redo stack (preserving original direction for redo)
 	s.history.Redo = append(s.history.Redo, lastTransition)
 
+	s.stack = nil
+
 	// Go to previous state
 	if lastTransition.FromID >= 0 {
-		stateMap := s.stateReg.Index()
-		if prevState, ok := stateMap[lastTransition.FromID]; ok {
-			s.store.Commit(func(_ *domain.State) (*domain.State, bool) {
-				return &prevState, true
-			})
+		if prevState, ok := s.stateWith(lastTransition.FromID, lastTransition.FromArgs); ok {
+			s.commit(&prevState, "Undo")
 		}
 	}
 
@@ -144,6 +173,8 @@ func (s *StateService) Undo() bool {
 }
 
 func (s *StateService) Redo() bool {
+	s.mu.Lock()
+	defer s.unlock()
 	if len(s.history.Redo) == 0 { return false }
 
 	// Pop from redo stack
@@ -153,21 +184,197 @@ func (s *StateService) Redo() bool {
 	// Move the redone transition back to undo stack
 	s.history.Undo = append(s.history.Undo, lastTransition)
 
+	s.stack = nil
+
 	// Go to the target state (the state we're redoing to)
-	stateMap := s.stateReg.Index()
-	if nextState, ok := stateMap[lastTransition.ToID]; ok {
-		s.store.Commit(func(_ *domain.State) (*domain.State, bool) {
-			return &nextState, true
-		})
+	if nextState, ok := s.stateWith(lastTransition.ToID, lastTransition.ToArgs); ok {
+		s.commit(&nextState, "Redo")
 	}
 
 	return true
 }
 
-func (s *StateService) Push(id int) error {
-	return s.SetNextState(id, nil)
+// Push opens id on top of the current state, remembering the current args
+// so Pop can return to exactly what was shown.
+func (s *StateService) Push(id int, mutateArgs func(map[string]interface{})) error {
+	s.mu.Lock()
+	defer s.unlock()
+	var frame *NavFrame
+	if curr := s.store.Current(); curr != nil {
+		frame = &NavFrame{StateID: curr.ID, Name: curr.ShortName(), Args: copyArgs(curr.Args)}
+	}
+	ok, err := s.transition(id, mutateArgs, "Push")
+	if ok && frame != nil {
+		s.stack = append(s.stack, *frame)
+	}
+	return err
 }
 
+// Pop returns to the state below the current one on the navigation stack.
 func (s *StateService) Pop() error {
-	return nil
+	s.mu.Lock()
+	defer s.unlock()
+	if len(s.stack) == 0 {
+		return fmt.Errorf("nothing to go back to")
+	}
+	frame := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	// over the registered args, a frame restored from a session only kept
+	// the scalar ones
+	_, err := s.transition(frame.StateID, func(a map[string]interface{}) {
+		for k, v := range frame.Args {
+			a[k] = v
+		}
+	}, "Pop")
+	return err
+}
+
+// Breadcrumbs names the states on the navigation stack, current one last.
+func (s *StateService) Breadcrumbs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, f := range s.stack {
+		out = append(out, f.Name)
+	}
+	if curr := s.store.Current(); curr != nil {
+		out = append(out, curr.ShortName())
+	}
+	return out
+}
+
+// OnChange calls fn after every state the service commits, with the cause,
+// and returns a func that stops it. fn runs once the commit released the
+// service's lock, on the committing goroutine or on one that is notifying
+// at the time.
+func (s *StateService) OnChange(fn func(StateChange)) func() {
+	s.obsMu.Lock()
+	defer s.obsMu.Unlock()
+	s.obsSeq++
+	id := s.obsSeq
+	s.observers = append(s.observers, observer{id: id, fn: fn})
+	return func() {
+		s.obsMu.Lock()
+		defer s.obsMu.Unlock()
+		for i, o := range s.observers {
+			if o.id == id {
+				s.observers = append(s.observers[:i:i], s.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// unlock releases mu, then tells the observers about the commits made
+// while it was held.
+func (s *StateService) unlock() {
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify drains pending unless another call, maybe further up this
+// goroutine's stack, already does, like DefaultStateStore.deliver.
+func (s *StateService) notify() {
+	s.obsMu.Lock()
+	if s.delivering {
+		s.obsMu.Unlock()
+		return
+	}
+	s.delivering = true
+	for len(s.pending) > 0 {
+		c := s.pending[0]
+		s.pending[0] = StateChange{}
+		s.pending = s.pending[1:]
+		obs := append([]observer(nil), s.observers...)
+		s.obsMu.Unlock()
+		for _, o := range obs {
+			o.fn(c)
+		}
+		s.obsMu.Lock()
+	}
+	s.delivering = false
+	s.obsMu.Unlock()
+}
+
+// Sorts returns the sort specification of every state that has one.
+func (s *StateService) Sorts() map[int]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sorts) == 0 {
+		return nil
+	}
+	out := make(map[int]string, len(s.sorts))
+	for id, v := range s.sorts {
+		out[id] = v
+	}
+	return out
+}
+
+// RestoreSorts puts back saved sort specifications for states that still
+// exist. They apply from the next visit of each state on.
+func (s *StateService) RestoreSorts(sorts map[int]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stateMap := s.stateReg.Index()
+	for id, v := range sorts {
+		if _, ok := stateMap[id]; !ok || v == "" {
+			continue
+		}
+		if s.sorts == nil {
+			s.sorts = map[int]string{}
+		}
+		s.sorts[id] = v
+	}
+}
+
+// stateFor copies the registered state id with args of its own and the
+// sort it was last shown with. Called with s.mu held.
+func (s *StateService) stateFor(stateMap map[int]domain.State, id int) (domain.State, bool) {
+	st, ok := stateMap[id]
+	if !ok {
+		return st, false
+	}
+	st.Args = copyArgs(st.Args)
+	if v, ok := s.sorts[id]; ok {
+		if _, set := st.Args[ArgSort]; !set {
+			st.Args[ArgSort] = v
+		}
+	}
+	return st, true
+}
+
+// stateWith is stateFor with args laid over the registered ones, e.g. those
+// a transition recorded. Called with s.mu held.
+func (s *StateService) stateWith(id int, args map[string]interface{}) (domain.State, bool) {
+	st, ok := s.stateFor(s.stateReg.Index(), id)
+	for k, v := range args {
+		st.Args[k] = v
+	}
+	return st, ok
+}
+
+// commit makes next the current state and queues the change for the
+// observers, with s.mu held. The caller's unlock notifies them.
+func (s *StateService) commit(next *domain.State, cause string) {
+	if v, _ := next.Args[ArgSort].(string); v != "" {
+		if s.sorts == nil {
+			s.sorts = map[int]string{}
+		}
+		s.sorts[next.ID] = v
+	} else {
+		delete(s.sorts, next.ID)
+	}
+	prev := s.store.Current()
+	s.store.Commit(func(_ *domain.State) (*domain.State, bool) { return next, true })
+	s.obsMu.Lock()
+	s.pending = append(s.pending, StateChange{From: prev, To: next, Cause: cause})
+	s.obsMu.Unlock()
+}
+
+func copyArgs(args map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		out[k] = v
+	}
+	return out
 }
\ No newline at end of file
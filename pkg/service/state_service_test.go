@@ -0,0 +1,232 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ourorg/goui/pkg/domain"
+)
+
+func newTestStates() (*StateService, *DefaultStateStore, *RegistryFacade) {
+	reg := NewRegistry()
+	reg.AddStates(
+		domain.State{ID: 0, ShortNameTmpl: "Home", Args: map[string]interface{}{"kind": "home"}},
+		domain.State{ID: 1, ShortNameTmpl: "Pods", Args: map[string]interface{}{"kind": "pods"}},
+	)
+	store := NewDefaultStateStore(reg.StateRegistry())
+	ss := NewStateService(store, reg.StateRegistry())
+	ss.Init(0)
+	return ss, store, reg
+}
+
+func TestCommittedArgsAreNotShared(t *testing.T) {
+	ss, _, reg := newTestStates()
+	before := ss.Current()
+	steps := map[string]func() error{
+		"UpdateArgs":   func() error { return ss.UpdateArgs(func(a map[string]interface{}) { a["n"] = 1 }) },
+		"SetNextState": func() error { return ss.SetNextState(0, func(a map[string]interface{}) { a["n"] = 2 }) },
+		"Push":         func() error { return ss.Push(1, func(a map[string]interface{}) { a["n"] = 3 }) },
+		"Pop":          func() error { return ss.Pop() },
+		"Restore":      func() error { return ss.Restore(0, map[string]interface{}{"n": 4}, StateHistory{}) },
+	}
+	for _, name := range []string{"UpdateArgs", "SetNextState", "Push", "Pop", "Restore"} {
+		want := copyArgs(before.Args)
+		if err := steps[name](); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(before.Args, want) {
+			t.Fatalf("%s changed the args of the state before it: %v, want %v", name, before.Args, want)
+		}
+		for _, st := range reg.StateRegistry().GetStates() {
+			if _, ok := st.Args["n"]; ok {
+				t.Fatalf("%s changed the args of registered state %d", name, st.ID)
+			}
+		}
+		before = ss.Current()
+	}
+}
+
+// Run with -race: async subscribers read args while commits go on.
+func TestConcurrentCommitsWithAsyncSubscriber(t *testing.T) {
+	ss, store, _ := newTestStates()
+	var seen sync.WaitGroup
+	stop := store.SubscribeAsync(func(st *domain.State) {
+		for k, v := range st.Args {
+			_ = fmt.Sprint(k, v)
+		}
+	}, 2)
+	defer stop()
+	unobserve := ss.OnChange(func(c StateChange) {
+		for k := range c.To.Args {
+			_ = k
+		}
+	})
+	defer unobserve()
+
+	for g := 0; g < 8; g++ {
+		seen.Add(1)
+		go func(g int) {
+			defer seen.Done()
+			for i := 0; i < 200; i++ {
+				switch i % 5 {
+				case 0:
+					ss.UpdateArgs(func(a map[string]interface{}) { a[fmt.Sprint("k", g)] = i })
+				case 1:
+					ss.SetNextState(i%2, func(a map[string]interface{}) { a["from"] = g })
+				case 2:
+					ss.Undo()
+					ss.Redo()
+				case 3:
+					ss.Push(1, nil)
+					ss.Pop()
+				case 4:
+					for k, v := range ss.Current().Args {
+						_ = fmt.Sprint(k, v)
+					}
+					_ = ss.History()
+					_ = ss.Breadcrumbs()
+				}
+			}
+		}(g)
+	}
+	seen.Wait()
+}
+
+func commitArg(store *DefaultStateStore, n int) {
+	store.Commit(func(curr *domain.State) (*domain.State, bool) {
+		next := *curr
+		next.Args = copyArgs(curr.Args)
+		next.Args["n"] = n
+		return &next, true
+	})
+}
+
+// A deadlock fails the test on its timeout.
+func TestSyncSubscriberMayCallBack(t *testing.T) {
+	_, store, _ := newTestStates()
+	var got []int
+	unsub := store.Subscribe(func(st *domain.State) {
+		n, _ := st.Args["n"].(int)
+		got = append(got, n)
+		if cur := store.Current(); cur == nil {
+			t.Error("Current returned nil inside a subscriber")
+		}
+		if n == 1 {
+			commitArg(store, 2) // delivered after this call returns
+		}
+	})
+	defer unsub()
+	commitArg(store, 1)
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("delivered %v, want [1 2] in order", got)
+	}
+}
+
+func TestUnsubscribeDuringDelivery(t *testing.T) {
+	_, store, _ := newTestStates()
+	var calls []string
+	var unsubB func()
+	unsubA := store.Subscribe(func(*domain.State) {
+		calls = append(calls, "a")
+		unsubB()
+	})
+	defer unsubA()
+	unsubB = store.Subscribe(func(*domain.State) { calls = append(calls, "b") })
+
+	commitArg(store, 1)
+	calls = nil
+	commitArg(store, 2)
+	if !reflect.DeepEqual(calls, []string{"a"}) {
+		t.Errorf("after unsubscribing b, calls = %v, want [a]", calls)
+	}
+
+	// unsubscribing itself mid-delivery, twice is harmless
+	var self func()
+	n := 0
+	self = store.Subscribe(func(*domain.State) { n++; self(); self() })
+	commitArg(store, 3)
+	commitArg(store, 4)
+	if n != 1 {
+		t.Errorf("self-unsubscribed subscriber called %d times, want 1", n)
+	}
+}
+
+func TestAsyncSubscriberCoalesces(t *testing.T) {
+	_, store, _ := newTestStates()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var mu sync.Mutex
+	var got []int
+	done := make(chan struct{})
+	stop := store.SubscribeAsync(func(st *domain.State) {
+		n, _ := st.Args["n"].(int)
+		if n == 1 {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		got = append(got, n)
+		mu.Unlock()
+		if n == 10 {
+			close(done)
+		}
+	}, 1)
+	defer stop()
+
+	commitArg(store, 1)
+	<-started // the subscriber holds state 1, the buffer is empty
+	for n := 2; n <= 10; n++ {
+		commitArg(store, n)
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("newest state never delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(got, []int{1, 10}) {
+		t.Errorf("delivered %v, want [1 10]", got)
+	}
+}
+
+func TestObserversMayCallBack(t *testing.T) {
+	ss, _, _ := newTestStates()
+	var causes []string
+	unobserve := ss.OnChange(func(c StateChange) {
+		causes = append(causes, c.Cause)
+		if ss.Current() == nil {
+			t.Error("Current returned nil inside an observer")
+		}
+		if c.Cause == "SetNextState" {
+			ss.UpdateArgs(func(a map[string]interface{}) { a["seen"] = true })
+		}
+	})
+	defer unobserve()
+	if err := ss.SetNextState(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(causes, []string{"SetNextState", "UpdateArgs"}) {
+		t.Errorf("observed %v", causes)
+	}
+	if ss.Current().Args["seen"] != true {
+		t.Error("the observer's update was lost")
+	}
+}
+
+func TestInitRejectsUnknownState(t *testing.T) {
+	ss, store, _ := newTestStates()
+	if err := store.Init(42); err == nil {
+		t.Error("store Init with an unknown ID should fail")
+	}
+	if err := ss.Init(42); err == nil {
+		t.Error("service Init with an unknown ID should fail")
+	}
+	if st := ss.Current(); st == nil || st.ID != 0 {
+		t.Errorf("current state = %v, want the initial one kept", st)
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ourorg/goui/pkg/domain"
+)
+
+// DefaultStateBuffer is how many states an async subscriber may lag behind
+// before newer states overwrite the newest queued one, see SubscribeAsync.
+const DefaultStateBuffer = 16
+
+// DefaultStateStore keeps the current state and tells subscribers about
+// every commit, safe for concurrent use.
+//
+// Subscribers are called outside the store lock, so they may read Current
+// or even Commit. Sync subscribers see commits in order, from whichever
+// goroutine is delivering at the time: a commit made while another
+// goroutine delivers returns before its own notification went out.
+type DefaultStateStore struct {
+	mu       sync.RWMutex
+	curr     *domain.State
+	stateReg *StateRegistry
+
+	subMu  sync.Mutex
+	seq    uint64
+	subs   map[uint64]func(*domain.State)
+	async  map[uint64]*asyncSub
+	queue  []*domain.State // commits waiting for sync delivery
+	active bool            // a goroutine is draining queue
+}
+
+func NewDefaultStateStore(reg *StateRegistry) *DefaultStateStore {
+	return &DefaultStateStore{
+		stateReg: reg,
+		subs:     map[uint64]func(*domain.State){},
+		async:    map[uint64]*asyncSub{},
+	}
+}
+
+func (s *DefaultStateStore) Init(initialID int) error {
+	if s.stateReg == nil {
+		return nil
+	}
+	stIdx := s.stateReg.Index()
+	if len(stIdx) == 0 {
+		return nil
+	}
+	curr, ok := stIdx[initialID]
+	if !ok {
+		return fmt.Errorf("no state found with ID: %d", initialID)
+	}
+	curr.Args = copyArgs(curr.Args) // the registry's map must never be shared
+	s.Commit(func(_ *domain.State) (*domain.State, bool) { return &curr, true })
+	return nil
+}
+
+func (s *DefaultStateStore) Current() *domain.State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.curr
+}
+
+// Commit replaces the current state with what f returns when it returns
+// true, then notifies the subscribers. f runs under the store lock and must
+// not call back into the store.
+func (s *DefaultStateStore) Commit(f func(*domain.State) (*domain.State, bool)) (*domain.State, bool) {
+	s.mu.Lock()
+	next, ok := f(s.curr)
+	if ok {
+		s.curr = next
+	}
+	curr := s.curr
+	if ok {
+		// queued before the state lock is released so the order of
+		// notifications is the order of commits
+		s.subMu.Lock()
+		s.queue = append(s.queue, next)
+		for _, a := range s.async {
+			a.push(next)
+		}
+		s.subMu.Unlock()
+	}
+	s.mu.Unlock()
+	if ok {
+		s.deliver()
+	}
+	return curr, ok
+}
+
+// deliver drains the sync queue unless another call, maybe further up
+// this goroutine's stack, already does.
+func (s *DefaultStateStore) deliver() {
+	s.subMu.Lock()
+	if s.active {
+		s.subMu.Unlock()
+		return
+	}
+	s.active = true
+	for len(s.queue) > 0 {
+		st := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		fns := make([]func(*domain.State), 0, len(s.subs))
+		for _, fn := range s.subs {
+			fns = append(fns, fn)
+		}
+		s.subMu.Unlock()
+		for _, fn := range fns {
+			fn(st)
+		}
+		s.subMu.Lock()
+	}
+	s.active = false
+	s.subMu.Unlock()
+}
+
+// Subscribe calls fn with every committed state, synchronously with the
+// commit, and returns a func that unsubscribes it. Calling it more than
+// once is harmless.
+func (s *DefaultStateStore) Subscribe(fn func(*domain.State)) func() {
+	if fn == nil {
+		return func() {}
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	s.seq++
+	id := s.seq
+	s.subs[id] = fn
+	return func() {
+		s.subMu.Lock()
+		delete(s.subs, id)
+		s.subMu.Unlock()
+	}
+}
+
+// SubscribeAsync calls fn with committed states on a goroutine of its own,
+// so a slow subscriber never holds up commits. Up to buffer states wait
+// for it, beyond that the newest queued one is replaced: fn may skip
+// intermediate states but always gets the latest. buffer <= 0 uses
+// DefaultStateBuffer. Unsubscribing drops what is still queued.
+func (s *DefaultStateStore) SubscribeAsync(fn func(*domain.State), buffer int) func() {
+	if fn == nil {
+		return func() {}
+	}
+	if buffer <= 0 {
+		buffer = DefaultStateBuffer
+	}
+	a := &asyncSub{
+		fn:   fn,
+		max:  buffer,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+	}
+	s.subMu.Lock()
+	s.seq++
+	id := s.seq
+	s.async[id] = a
+	s.subMu.Unlock()
+	go a.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.subMu.Lock()
+			delete(s.async, id)
+			s.subMu.Unlock()
+			close(a.quit)
+		})
+	}
+}
+
+type asyncSub struct {
+	fn  func(*domain.State)
+	max int
+
+	mu    sync.Mutex
+	queue []*domain.State
+	wake  chan struct{}
+	quit  chan struct{}
+}
+
+// push queues st, coalescing into the newest entry when the buffer is full.
+func (a *asyncSub) push(st *domain.State) {
+	a.mu.Lock()
+	if len(a.queue) >= a.max {
+		a.queue[len(a.queue)-1] = st
+	} else {
+		a.queue = append(a.queue, st)
+	}
+	a.mu.Unlock()
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *asyncSub) run() {
+	for {
+		select {
+		case <-a.quit:
+			return
+		case <-a.wake:
+		}
+		for {
+			a.mu.Lock()
+			if len(a.queue) == 0 {
+				a.mu.Unlock()
+				break
+			}
+			st := a.queue[0]
+			a.queue[0] = nil
+			a.queue = a.queue[1:]
+			a.mu.Unlock()
+			select {
+			case <-a.quit:
+				return
+			default:
+			}
+			a.fn(st)
+		}
+	}
+}
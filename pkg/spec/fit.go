@@ -0,0 +1,137 @@
+package spec
+
+import "unicode/utf8"
+
+// ColGap is the number of blank cells Fit reserves between columns
+const ColGap = 1
+
+// minColWidth keeps shrunk columns readable, wide enough for "ab…"
+const minColWidth = 3
+
+// Fit projects the table onto a terminal width so renderers lay out columns
+// the same way. Hidden columns are removed, each column gets a Width from its
+// content capped by MaxWidth, and when the result is still too wide the
+// columns with the highest Nice (the rightmost on ties) are dropped until it
+// fits. A lone remaining column is shrunk instead. width <= 0 skips fitting.
+//
+// Only renderers know the terminal width, so the engine never calls Fit: a
+// renderer calls it on every table spec it draws, which is also where the
+// hidden columns and widths set by "col" take effect.
+func (t *Table) Fit(width int) *Table {
+	schema := t.ColSchema
+	var idxs []int
+	for i := range t.Headers {
+		if i >= len(schema) || schema[i].Visible {
+			idxs = append(idxs, i)
+		}
+	}
+
+	widths := make(map[int]int, len(idxs))
+	for _, i := range idxs {
+		w := utf8.RuneCountInString(t.Headers[i])
+		for _, e := range t.Entries {
+			if i < len(e.Values) {
+				if n := utf8.RuneCountInString(e.Values[i]); n > w {
+					w = n
+				}
+			}
+		}
+		if i < len(schema) && schema[i].MaxWidth > 0 && w > schema[i].MaxWidth {
+			w = schema[i].MaxWidth
+		}
+		widths[i] = w
+	}
+
+	total := func() int {
+		sum := 0
+		for _, i := range idxs {
+			sum += widths[i]
+		}
+		if len(idxs) > 1 {
+			sum += ColGap * (len(idxs) - 1)
+		}
+		return sum
+	}
+
+	if width > 0 {
+		for len(idxs) > 1 && total() > width {
+			drop := len(idxs) - 1
+			for k := len(idxs) - 1; k >= 0; k-- {
+				if nice(schema, idxs[k]) > nice(schema, idxs[drop]) {
+					drop = k
+				}
+			}
+			idxs = append(idxs[:drop:drop], idxs[drop+1:]...)
+		}
+		if len(idxs) == 1 && widths[idxs[0]] > width {
+			w := width
+			if w < minColWidth {
+				w = minColWidth
+			}
+			widths[idxs[0]] = w
+		}
+	}
+
+	out := *t
+	out.Headers = make([]string, len(idxs))
+	out.ColSchema = make([]ColMeta, len(idxs))
+	for k, i := range idxs {
+		out.Headers[k] = t.Headers[i]
+		if i < len(schema) {
+			out.ColSchema[k] = schema[i]
+		}
+		out.ColSchema[k].Visible = true
+		out.ColSchema[k].Width = widths[i]
+	}
+	out.Entries = make([]Entry, len(t.Entries))
+	for n, e := range t.Entries {
+		vals := make([]string, len(idxs))
+		var matches [][]int
+		if e.Matches != nil {
+			matches = make([][]int, len(idxs))
+		}
+		for k, i := range idxs {
+			if i < len(e.Values) {
+				vals[k] = e.Values[i]
+			}
+			if matches != nil && i < len(e.Matches) {
+				matches[k] = e.Matches[i]
+			}
+		}
+		e.Values, e.Matches = vals, matches
+		out.Entries[n] = e
+	}
+	out.Rows = make([][]string, len(out.Entries))
+	for n, e := range out.Entries {
+		out.Rows[n] = e.Values
+	}
+	var keys []SortKey
+	for _, sk := range t.SortKeys {
+		for k, i := range idxs {
+			if i == sk.Col {
+				keys = append(keys, SortKey{Col: k, Desc: sk.Desc})
+			}
+		}
+	}
+	out.SortKeys = keys
+	return &out
+}
+
+// Truncate shortens s to width runes, marking the cut with an ellipsis.
+func Truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	rs := []rune(s)
+	if width == 1 {
+		return "…"
+	}
+	return string(rs[:width-1]) + "…"
+}
+
+func nice(schema []ColMeta, i int) int {
+	if i < len(schema) {
+		return schema[i].Nice
+	}
+	return 0
+}
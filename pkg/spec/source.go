@@ -0,0 +1,41 @@
+package spec
+
+// Source is a windowed data source for tables (Source[Entry]) and lists
+// (Source[ListItem]). Specs built from a source only carry the visible page,
+// so sources can hold far more rows than are ever materialized at once.
+type Source[T any] interface {
+	// Len is the number of rows, after any filtering the source applied
+	Len() int
+	// Fetch returns up to limit rows starting at offset
+	Fetch(offset, limit int) []T
+}
+
+// Filterable sources take the search term themselves instead of the spec
+// pipeline filtering only the fetched page.
+type Filterable[T any] interface {
+	Source[T]
+	Filter(term string) (Source[T], error)
+}
+
+// Sortable sources order all rows, spec is a sort specification such as
+// "cpu desc, name".
+type Sortable[T any] interface {
+	Source[T]
+	Sort(spec string) (Source[T], error)
+}
+
+// Window describes which page of a source a table or list shows
+type Window struct {
+	Offset int
+	Size   int
+	Total  int
+
+	// Set when the source already applied the search term or sort
+	Filtered bool
+	Sorted   bool
+}
+
+// HasNext reports whether rows follow the current page
+func (w *Window) HasNext() bool {
+	return w.Offset+w.Size < w.Total
+}
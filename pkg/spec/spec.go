@@ -1,5 +1,7 @@
 package spec
 
+import "fmt"
+
 type Kind int
 
 const (
@@ -8,24 +10,44 @@ const (
 	KindList
 )
 
+// Column types understood by search and sorting, untyped columns are inferred
+const (
+	ColString   = "string" // natural order, "item2" before "item10"
+	ColNumber   = "number"
+	ColSize     = "size" // human sizes like 12Mi, 1.5G, 512KB
+	ColDuration = "duration"
+	ColTime     = "time"
+	ColSemver   = "semver"
+)
+
 // New in TODO19: Enhanced table model with entries and column metadata
 type ColMeta struct {
 	Type     string
+	// Higher values are dropped first when the table does not fit
 	Nice     int
 	MaxWidth int
 	Visible  bool
+
+	// Display width computed by Table.Fit
+	Width int
 }
 
 // New in TODO19: Entry with stable ID for selection persistence
 type Entry struct {
 	ID     string
 	Values []string
+
+	// Rune positions matched by the search term, per value, for highlighting
+	Matches [][]int
 }
 
 type ListItem struct {
 	Main      string
 	Secondary string
 	Shortcut  rune
+
+	// Rune positions in Main matched by the search term, for highlighting
+	Matches []int
 }
 
 type Table struct {
@@ -40,6 +62,51 @@ type Table struct {
 
 	// Optional column schema
 	ColSchema []ColMeta
+
+	// Set when entries are grouped, each group is a contiguous run of Entries
+	Groups []Group
+
+	// Active sort keys, most significant first, for header indicators
+	SortKeys []SortKey
+
+	// Set when Entries is one page of a Source
+	Window *Window
+}
+
+// SortKey marks a column the table is sorted by
+type SortKey struct {
+	Col  int
+	Desc bool
+}
+
+// HeaderLabel returns the header with a sort indicator, numbered by
+// priority when the table is sorted by more than one column.
+func (t *Table) HeaderLabel(col int) string {
+	if col < 0 || col >= len(t.Headers) {
+		return ""
+	}
+	h := t.Headers[col]
+	for i, k := range t.SortKeys {
+		if k.Col != col {
+			continue
+		}
+		arrow := "▲"
+		if k.Desc {
+			arrow = "▼"
+		}
+		if len(t.SortKeys) > 1 {
+			return fmt.Sprintf("%s %s%d", h, arrow, i+1)
+		}
+		return h + " " + arrow
+	}
+	return h
+}
+
+// Group is a run of table entries sharing the same value in the group column
+type Group struct {
+	Key   string
+	Start int
+	Count int
 }
 
 type Text struct {
@@ -50,6 +117,9 @@ type Text struct {
 type List struct {
 	Title string
 	Items []ListItem
+
+	// Set when Items is one page of a Source
+	Window *Window
 }
 
 type Spec struct {
@@ -60,4 +130,13 @@ type Spec struct {
 
 	// New: selected IDs (table or list)
 	Selection []string
+
+	// Message for the info line produced while building, e.g. a bad search query
+	Info string
+
+	// Names of the drill-down path to this view, current one last
+	Breadcrumbs []string
+
+	// Status line summary, e.g. where commands run
+	Status string
 }
\ No newline at end of file
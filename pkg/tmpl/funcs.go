@@ -0,0 +1,207 @@
+package tmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ourorg/goui/pkg/secret"
+	"github.com/ourorg/goui/pkg/spec"
+)
+
+// Funcs returns a fresh copy of the function library:
+//
+//	default "none" .ns        .ns, or "none" when empty
+//	join ", " .Selection      join a list
+//	upper, lower              change case
+//	truncate 20 .Name         cut to 20 runes with an ellipsis
+//	duration .Age             3d4h from a time.Duration, seconds or "100h"
+//	bytes .Size               1.5 GiB from a byte count
+//	json .                    JSON encoding
+//	env "HOME"                environment variable
+//	first, last, count        selection helpers, e.g. first .Selection
+//	arg "ns" .                state arg by name, from the data or its State
+//	secret "env:TOKEN"        secret value, masked wherever it is shown
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"default":  defaultValue,
+		"join":     join,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"truncate": func(n int, s string) string { return spec.Truncate(s, n) },
+		"duration": humanDuration,
+		"bytes":    humanBytes,
+		"json":     toJSON,
+		"env":      os.Getenv,
+		"first":    first,
+		"last":     last,
+		"count":    func(v interface{}) int { return len(toStrings(v)) },
+		"arg":      arg,
+		"secret":   secret.Lookup,
+	}
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+func first(v interface{}) string {
+	if l := toStrings(v); len(l) > 0 {
+		return l[0]
+	}
+	return ""
+}
+
+func last(v interface{}) string {
+	if l := toStrings(v); len(l) > 0 {
+		return l[len(l)-1]
+	}
+	return ""
+}
+
+func join(sep string, v interface{}) string {
+	return strings.Join(toStrings(v), sep)
+}
+
+// arg looks a state arg up in template data: the data map itself, as for
+// state names, then its "State" map, as for commands. Missing args are "".
+func arg(name string, data interface{}) interface{} {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if v, ok := m[name]; ok {
+		return v
+	}
+	if st, ok := m["State"].(map[string]interface{}); ok {
+		if v, ok := st[name]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// humanDuration prints the two most significant units, like kubectl ages.
+func humanDuration(v interface{}) (string, error) {
+	var d time.Duration
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case time.Time:
+		d = time.Since(v)
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case string:
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("duration: unsupported %T", v)
+	}
+	if d < 0 {
+		d = -d
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}}
+	var parts []string
+	for _, u := range units {
+		n := d / u.size
+		if n == 0 {
+			if len(parts) > 0 {
+				break // adjacent units only, 3d rather than 3d0h5m
+			}
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d%s", n, u.name))
+		d -= n * u.size
+		if len(parts) == 2 {
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "0s", nil
+	}
+	return strings.Join(parts, ""), nil
+}
+
+// humanBytes prints a byte count with binary units, e.g. 1.5 GiB.
+func humanBytes(v interface{}) (string, error) {
+	var n float64
+	switch v := v.(type) {
+	case int:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case uint64:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return "", fmt.Errorf("bytes: unsupported %T", v)
+	}
+	if math.Abs(n) < 1024 {
+		return fmt.Sprintf("%.0f B", n), nil
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	i := -1
+	for math.Abs(n) >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	s := fmt.Sprintf("%.1f", n)
+	return strings.TrimSuffix(s, ".0") + " " + units[i], nil
+}
+
+func toStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		out := make([]string, rv.Len())
+		for i := range out {
+			out[i] = fmt.Sprint(rv.Index(i).Interface())
+		}
+		return out
+	}
+	return []string{fmt.Sprint(v)}
+}
@@ -0,0 +1,31 @@
+package tmpl
+
+import (
+	"testing"
+
+	"github.com/ourorg/goui/pkg/secret"
+)
+
+// env is a plain lookup, only the secret function registers values for
+// redaction.
+func TestEnvDoesNotRegisterSecrets(t *testing.T) {
+	t.Setenv("GOUI_TMPL_TEST_ENV", "plain-env-value")
+	out, err := Render(`{{env "GOUI_TMPL_TEST_ENV"}}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "plain-env-value" {
+		t.Fatalf("env rendered %q, want plain-env-value", out)
+	}
+	if got := secret.Redact("value is plain-env-value"); got != "value is plain-env-value" {
+		t.Errorf("Redact after env = %q, want it unchanged", got)
+	}
+
+	t.Setenv("GOUI_TMPL_TEST_SECRET", "secret-env-value")
+	if _, err := Render(`{{secret "env:GOUI_TMPL_TEST_SECRET"}}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := secret.Redact("value is secret-env-value"); got != "value is "+secret.Mask {
+		t.Errorf("Redact after secret = %q, want the value masked", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Package tmpl is the shared template engine for state names, drill-down
+// args and commands. Templates are parsed once and cached, and all of them
+// see the same function library, see Funcs.
+package tmpl
+
+import (
+	"bytes"
+	"sync"
+	"text/template"
+)
+
+// maxCached bounds a Cache, it starts over when full.
+const maxCached = 512
+
+// Option configures how one template renders.
+type Option func(*options)
+
+type options struct {
+	strict bool
+}
+
+// Strict fails on missing map keys instead of printing "<no value>".
+var Strict Option = func(o *options) { o.strict = true }
+
+// Cache parses templates with a function map once per text and options.
+type Cache struct {
+	funcs   template.FuncMap
+	prepare func(*template.Template)
+
+	mu      sync.RWMutex
+	entries map[cacheKey]*template.Template
+}
+
+type cacheKey struct {
+	text   string
+	strict bool
+}
+
+// NewCache creates a cache whose templates see Funcs plus extra, extra
+// winning on name clashes. prepare, if set, runs once on each parsed
+// template, e.g. to rewrite its tree.
+func NewCache(extra template.FuncMap, prepare func(*template.Template)) *Cache {
+	funcs := Funcs()
+	for k, v := range extra {
+		funcs[k] = v
+	}
+	return &Cache{funcs: funcs, prepare: prepare}
+}
+
+// Parse returns the cached template for text, parsing it on first use.
+func (c *Cache) Parse(text string, opts ...Option) (*template.Template, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	key := cacheKey{text: text, strict: o.strict}
+	c.mu.RLock()
+	t, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	t = template.New("tmpl").Funcs(c.funcs)
+	if o.strict {
+		t = t.Option("missingkey=error")
+	}
+	t, err := t.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if c.prepare != nil {
+		c.prepare(t)
+	}
+	c.mu.Lock()
+	if c.entries == nil || len(c.entries) >= maxCached {
+		c.entries = map[cacheKey]*template.Template{}
+	}
+	c.entries[key] = t
+	c.mu.Unlock()
+	return t, nil
+}
+
+// Render parses text through the cache and executes it with data.
+func (c *Cache) Render(text string, data interface{}, opts ...Option) (string, error) {
+	t, err := c.Parse(text, opts...)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var defaultCache = NewCache(nil, nil)
+
+// Render renders text with the default cache.
+func Render(text string, data interface{}, opts ...Option) (string, error) {
+	return defaultCache.Render(text, data, opts...)
+}
@@ -1,32 +1,32 @@
 package util
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
-	"text/template"
+	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/ourorg/goui/pkg/tmpl"
 )
 
-// ProcessTemplate processes a template string with the given arguments
+// RenderTemplate renders a template with the shared function library, see
+// package tmpl. Pass tmpl.Strict to fail on missing keys.
+func RenderTemplate(tmplStr string, args map[string]interface{}, opts ...tmpl.Option) (string, error) {
+	return tmpl.Render(tmplStr, args, opts...)
+}
+
+// ProcessTemplate renders names and labels. A broken template is logged and
+// shown as written, so a typo never replaces a title with an error message.
 func ProcessTemplate(tmplStr string, args map[string]interface{}) string {
 	logrus.Debugf("Processing template: %s", tmplStr)
-	tmpl, err := template.New("stateName").Parse(tmplStr)
+	out, err := tmpl.Render(tmplStr, args)
 	if err != nil {
-		logrus.Errorf("Failed to parse template: %v", err)
-		return fmt.Sprintf("Error parsing template: %v", err)
+		logrus.Errorf("Failed to render template %q: %v", tmplStr, err)
+		return tmplStr
 	}
-
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, args)
-	if err != nil {
-		logrus.Errorf("Failed to execute template: %v", err)
-		return fmt.Sprintf("Error executing template: %v", err)
-	}
-
-	return buf.String()
+	return out
 }
 
 // EnsureFileExists creates a directory if it doesn't exist and returns a file handle for appending
@@ -50,4 +50,66 @@ func EnsureFileExists(path string) (*os.File, error) {
 		return nil, err
 	}
 	return file, nil
-}
\ No newline at end of file
+}
+
+// staleLockAge is how old a lock file must be before it is considered abandoned
+const staleLockAge = 30 * time.Second
+
+// LockFile takes an exclusive advisory lock next to path, shared by all
+// processes using the same path. The returned func releases the lock.
+func LockFile(path string, timeout time.Duration) (func(), error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		// A stale lock that cannot be removed must not keep us here past
+		// the deadline, so check it on every pass.
+		broke := false
+		if fi, serr := os.Stat(lockPath); serr == nil && time.Since(fi.ModTime()) > staleLockAge {
+			broke = breakStaleLock(lockPath, fi)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		if !broke {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// breakStaleLock removes lockPath if it is still the stale file described by
+// stale. Breakers serialize on a second lock file and re-check the lock's
+// identity, so a waiter that saw the old lock never removes one another
+// process has taken since. It reports whether the lock was removed.
+func breakStaleLock(lockPath string, stale os.FileInfo) bool {
+	breakPath := lockPath + ".break"
+	f, err := os.OpenFile(breakPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		// Another waiter is breaking it; a breaker that died mid-way is cleared
+		// the same way as a stale lock.
+		if fi, serr := os.Stat(breakPath); serr == nil && time.Since(fi.ModTime()) > staleLockAge {
+			os.Remove(breakPath)
+		}
+		return false
+	}
+	f.Close()
+	defer os.Remove(breakPath)
+
+	cur, err := os.Stat(lockPath)
+	if err != nil || !os.SameFile(stale, cur) || !cur.ModTime().Equal(stale.ModTime()) {
+		return false
+	}
+	logrus.Warnf("Removing stale lock file: %s", lockPath)
+	return os.Remove(lockPath) == nil
+}